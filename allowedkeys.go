@@ -0,0 +1,274 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/AlecAivazis/survey/v2"
+	"github.com/AlecAivazis/survey/v2/terminal"
+)
+
+// --- Allowed Public Keys ---
+
+// AllowedKey is an entry of AllowedPublicKeys. The label is kept as a
+// comment line above the key, which HJSON configs preserve.
+type AllowedKey struct {
+	Key   string
+	Label string
+}
+
+func normalizePublicKey(s string) (string, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	b, err := hex.DecodeString(s)
+	if err != nil || len(b) != 32 {
+		return "", fmt.Errorf("public keys are 64 hex characters")
+	}
+	return s, nil
+}
+
+// shortKey abbreviates a hex key for menus.
+func shortKey(key string) string {
+	if len(key) <= 16 {
+		return key
+	}
+	return key[:16] + "…"
+}
+
+func readAllowedKeys(cfg *Config) []AllowedKey {
+	var keys []AllowedKey
+	n := cfg.Get("AllowedPublicKeys")
+	if n == nil {
+		return keys
+	}
+	for _, item := range n.Children {
+		if item.Kind != NodeString {
+			continue
+		}
+		keys = append(keys, AllowedKey{Key: item.Value, Label: commentLabel(item)})
+	}
+	return keys
+}
+
+// commentLabel returns the text of the last comment line above a node.
+func commentLabel(n *Node) string {
+	for i := len(n.Comments) - 1; i >= 0; i-- {
+		c := strings.TrimSpace(n.Comments[i])
+		if c == "" {
+			continue
+		}
+		for _, marker := range []string{"#", "//"} {
+			if strings.HasPrefix(c, marker) {
+				return strings.TrimSpace(strings.TrimPrefix(c, marker))
+			}
+		}
+		return ""
+	}
+	return ""
+}
+
+// addAllowedKeys adds keys with their labels, skipping keys already present.
+func addAllowedKeys(cfg *Config, keys []AllowedKey) int {
+	n := cfg.Get("AllowedPublicKeys")
+	if n == nil || n.Kind != NodeArray {
+		n = newArrayNode()
+		cfg.Set("AllowedPublicKeys", n)
+	}
+	added := 0
+	for _, k := range keys {
+		dup := false
+		for _, item := range n.Children {
+			if strings.EqualFold(item.Value, k.Key) {
+				dup = true
+				break
+			}
+		}
+		if dup {
+			continue
+		}
+		item := newStringNode(k.Key)
+		if k.Label != "" {
+			item.Comments = []string{"# " + k.Label}
+		}
+		n.Children = append(n.Children, item)
+		added++
+	}
+	return added
+}
+
+func removeAllowedKeys(cfg *Config, keys []string) {
+	n := cfg.Get("AllowedPublicKeys")
+	if n == nil {
+		return
+	}
+	var keep []*Node
+	for _, item := range n.Children {
+		remove := false
+		for _, k := range keys {
+			if strings.EqualFold(item.Value, k) {
+				remove = true
+				break
+			}
+		}
+		if !remove {
+			keep = append(keep, item)
+		}
+	}
+	n.Children = keep
+}
+
+func (k AllowedKey) Display() string {
+	if k.Label == "" {
+		return k.Key
+	}
+	return fmt.Sprintf("%s (%s)", k.Key, k.Label)
+}
+
+// askKeysFromPeers offers the keys of currently connected peers for import.
+func askKeysFromPeers(existing []AllowedKey) []AllowedKey {
+	peers, err := getLivePeers()
+	if err != nil {
+		fmt.Println(red("Error getting peer status: "), err)
+		fmt.Println(yellow("Make sure Yggdrasil service is running."))
+		waitEnter()
+		return nil
+	}
+
+	allowed := map[string]bool{}
+	for _, k := range existing {
+		allowed[strings.ToLower(k.Key)] = true
+	}
+	var candidates []PeerStatus
+	var options []string
+	for _, p := range peers {
+		if p.Key == "" || allowed[p.Key] || !p.Up {
+			continue
+		}
+		allowed[p.Key] = true // Same key may be connected more than once
+		direction := "outbound"
+		if p.Inbound {
+			direction = "inbound"
+		}
+		candidates = append(candidates, p)
+		options = append(options, fmt.Sprintf("%s %s (%s)", shortKey(p.Key), p.URI, direction))
+	}
+	if len(candidates) == 0 {
+		fmt.Println(yellow("No connected peers with keys that aren't already allowed."))
+		waitEnter()
+		return nil
+	}
+
+	var picked []int
+	if err := survey.AskOne(&survey.MultiSelect{Message: "Allow peers:", Options: options}, &picked); err != nil {
+		return nil
+	}
+	var keys []AllowedKey
+	for _, i := range picked {
+		label := ""
+		survey.AskOne(&survey.Input{
+			Message: fmt.Sprintf("Label for %s:", shortKey(candidates[i].Key)),
+			Default: candidates[i].URI,
+		}, &label)
+		keys = append(keys, AllowedKey{Key: candidates[i].Key, Label: label})
+	}
+	return keys
+}
+
+func askPastedKey() []AllowedKey {
+	key := ""
+	err := survey.AskOne(&survey.Input{Message: "Public key (64 hex characters):"}, &key,
+		survey.WithValidator(func(ans interface{}) error {
+			_, err := normalizePublicKey(ans.(string))
+			return err
+		}))
+	if err != nil {
+		return nil
+	}
+	key, _ = normalizePublicKey(key)
+	label := ""
+	survey.AskOne(&survey.Input{Message: "Label (optional):"}, &label)
+	return []AllowedKey{{Key: key, Label: strings.TrimSpace(label)}}
+}
+
+func allowedKeysMenu() {
+	for {
+		clearScreen()
+		fmt.Println(cyan("=== Allowed Public Keys (inbound allowlist) ===\n"))
+		cfg, err := loadConfig(detectedConfigPath)
+		if err != nil {
+			fmt.Println(red("Error: "), err)
+			waitEnter()
+			return
+		}
+		keys := readAllowedKeys(cfg)
+		if len(keys) == 0 {
+			fmt.Println(yellow("List is empty: any node may peer with this one."))
+		}
+		for i, k := range keys {
+			fmt.Printf("%d. %s\n", i+1, k.Display())
+		}
+		if cfg.Doc.JSON {
+			fmt.Println(yellow("\nNote: this config is plain JSON, so labels can't be stored."))
+		}
+		fmt.Println()
+
+		action := ""
+		err = survey.AskOne(&survey.Select{
+			Message: "Allowed Keys Menu (Esc to back):",
+			Options: []string{"Import From Connected Peers", "Paste Key", "Remove Keys", "Back"},
+		}, &action)
+		if err == terminal.InterruptErr || action == "Back" || action == "" {
+			return
+		}
+
+		var toAdd []AllowedKey
+		switch action {
+		case "Import From Connected Peers":
+			toAdd = askKeysFromPeers(keys)
+		case "Paste Key":
+			toAdd = askPastedKey()
+		case "Remove Keys":
+			if len(keys) == 0 {
+				continue
+			}
+			options := []string{}
+			for _, k := range keys {
+				options = append(options, k.Display())
+			}
+			var picked []int
+			if err := survey.AskOne(&survey.MultiSelect{Message: "Select to Remove:", Options: options}, &picked); err != nil || len(picked) == 0 {
+				continue
+			}
+			var remove []string
+			for _, i := range picked {
+				remove = append(remove, keys[i].Key)
+			}
+			removeAllowedKeys(cfg, remove)
+			if len(remove) == len(keys) {
+				fmt.Println(yellow("The list is now empty: any node will be able to peer with this one."))
+			}
+		}
+
+		if action != "Remove Keys" {
+			if len(toAdd) == 0 {
+				continue
+			}
+			if len(keys) == 0 {
+				fmt.Println(yellow("Once the list is not empty, only these keys may peer inbound (including over multicast)."))
+			}
+			if addAllowedKeys(cfg, toAdd) == 0 {
+				fmt.Println(yellow("Keys are already allowed."))
+				waitEnter()
+				continue
+			}
+		}
+
+		if err := cfg.Save(); err != nil {
+			fmt.Println(red("Failed to update config: "), err)
+			waitEnter()
+			continue
+		}
+		fmt.Println(green("AllowedPublicKeys updated."))
+		restartServicePrompt()
+	}
+}
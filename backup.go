@@ -0,0 +1,359 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AlecAivazis/survey/v2"
+)
+
+// --- Config Backups ---
+
+const (
+	backupDirName   = ".ygglazy-backups"
+	backupTimeFmt   = "20060102-150405"
+	maxConfigBackup = 10
+)
+
+type ConfigBackup struct {
+	Path string
+	Time time.Time
+	seq  int // Tie-breaker for backups taken within the same second
+}
+
+// writeFileAtomic writes data to a temp file in the same directory, syncs it
+// and renames it over path, so readers never see a half-written file. The
+// temp file takes the owner and group of the file it replaces: packaged
+// configs are often root:yggdrasil 0640, and the service must still read them.
+func writeFileAtomic(path string, data []byte, mode os.FileMode) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName) // No-op once the rename succeeded
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if info, err := os.Stat(path); err == nil {
+		if uid, gid, ok := fileOwner(info); ok {
+			if err := os.Chown(tmpName, uid, gid); err != nil {
+				return fmt.Errorf("keeping the owner of %s: %v", path, err)
+			}
+		}
+	}
+	if err := os.Chmod(tmpName, mode); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpName, path); err != nil {
+		return err
+	}
+
+	// Persist the rename itself. Directories can't be opened on Windows.
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
+
+func configBackupDir(configPath string) string {
+	return filepath.Join(filepath.Dir(configPath), backupDirName)
+}
+
+// backupConfig copies the current config into the backup directory and
+// prunes the oldest backups. It returns the path of the new backup.
+func backupConfig(configPath string) (string, error) {
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return "", err
+	}
+	dir := configBackupDir(configPath)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+
+	// The config holds the private key, so backups are readable by root only
+	name := fmt.Sprintf("%s.%s.bak", filepath.Base(configPath), time.Now().Format(backupTimeFmt))
+	backupPath := filepath.Join(dir, name)
+	for i := 1; fileExists(backupPath); i++ {
+		backupPath = filepath.Join(dir, fmt.Sprintf("%s.%s-%d.bak", filepath.Base(configPath), time.Now().Format(backupTimeFmt), i))
+	}
+	if err := writeFileAtomic(backupPath, data, 0600); err != nil {
+		return "", err
+	}
+
+	backups, err := listConfigBackups(configPath)
+	if err == nil && len(backups) > maxConfigBackup {
+		for _, b := range backups[maxConfigBackup:] {
+			os.Remove(b.Path)
+		}
+	}
+	return backupPath, nil
+}
+
+// listConfigBackups returns the backups of configPath, newest first.
+func listConfigBackups(configPath string) ([]ConfigBackup, error) {
+	dir := configBackupDir(configPath)
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := filepath.Base(configPath) + "."
+	var backups []ConfigBackup
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, ".bak") {
+			continue
+		}
+		stamp := strings.TrimSuffix(strings.TrimPrefix(name, prefix), ".bak")
+		seq := 0
+		if strings.Count(stamp, "-") > 1 {
+			i := strings.LastIndex(stamp, "-")
+			seq, _ = strconv.Atoi(stamp[i+1:])
+			stamp = stamp[:i]
+		}
+		t, err := time.ParseInLocation(backupTimeFmt, stamp, time.Local)
+		if err != nil {
+			continue
+		}
+		backups = append(backups, ConfigBackup{Path: filepath.Join(dir, name), Time: t, seq: seq})
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		if backups[i].Time.Equal(backups[j].Time) {
+			return backups[i].seq > backups[j].seq
+		}
+		return backups[i].Time.After(backups[j].Time)
+	})
+	return backups, nil
+}
+
+// restoreConfigBackup puts a backup back in place. The current config is
+// backed up first, so a restore can itself be rolled back.
+func restoreConfigBackup(configPath string, b ConfigBackup) error {
+	data, err := os.ReadFile(b.Path)
+	if err != nil {
+		return err
+	}
+	if _, err := parseDocument(data); err != nil {
+		return fmt.Errorf("backup is not a valid config: %v", err)
+	}
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(configPath); err == nil {
+		mode = info.Mode().Perm()
+		backup, err := backupConfig(configPath)
+		if err != nil {
+			return fmt.Errorf("could not back up current config: %v", err)
+		}
+		noteConfigBackup(backup)
+	}
+	return writeFileAtomic(configPath, data, mode)
+}
+
+// diffLines returns a line diff of a against b, with "-" for lines only in
+// a and "+" for lines only in b. Unchanged lines are left out.
+func diffLines(a, b string) []string {
+	x := strings.Split(strings.TrimSuffix(a, "\n"), "\n")
+	y := strings.Split(strings.TrimSuffix(b, "\n"), "\n")
+
+	// Longest common subsequence table
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var out []string
+	i, j := 0, 0
+	for i < len(x) && j < len(y) {
+		switch {
+		case x[i] == y[j]:
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			out = append(out, "- "+x[i])
+			i++
+		default:
+			out = append(out, "+ "+y[j])
+			j++
+		}
+	}
+	for ; i < len(x); i++ {
+		out = append(out, "- "+x[i])
+	}
+	for ; j < len(y); j++ {
+		out = append(out, "+ "+y[j])
+	}
+	return out
+}
+
+// printBackupDiff shows what restoring a backup would change.
+func printBackupDiff(configPath string, b ConfigBackup) {
+	current, _ := os.ReadFile(configPath)
+	old, err := os.ReadFile(b.Path)
+	if err != nil {
+		fmt.Println(red("Cannot read backup: "), err)
+		return
+	}
+	diff := diffLines(string(current), string(old))
+	if len(diff) == 0 {
+		fmt.Println(green("Backup is identical to the current config."))
+		return
+	}
+	fmt.Println(cyan("Changes if restored (- current, + backup):"))
+	for _, line := range diff {
+		if strings.HasPrefix(line, "-") {
+			fmt.Println(red(line))
+		} else {
+			fmt.Println(green(line))
+		}
+	}
+}
+
+func printBackupList(backups []ConfigBackup) {
+	for i, b := range backups {
+		fmt.Printf("%d. %s (%s ago)\n", i+1, b.Time.Format("2006-01-02 15:04:05"),
+			time.Since(b.Time).Round(time.Second))
+	}
+}
+
+// restoreConfigMenu lets the user pick a backup, review the diff and restore it.
+func restoreConfigMenu() {
+	clearScreen()
+	fmt.Println(cyan("=== Restore Previous Config ===\n"))
+
+	backups, err := listConfigBackups(detectedConfigPath)
+	if err != nil {
+		fmt.Println(red("Error reading backups: "), err)
+		waitEnter()
+		return
+	}
+	if len(backups) == 0 {
+		fmt.Println(yellow("No backups found in " + configBackupDir(detectedConfigPath)))
+		waitEnter()
+		return
+	}
+
+	options := []string{}
+	for _, b := range backups {
+		options = append(options, fmt.Sprintf("%s (%s ago)", b.Time.Format("2006-01-02 15:04:05"),
+			time.Since(b.Time).Round(time.Second)))
+	}
+	options = append(options, "Back")
+
+	choice := 0
+	err = survey.AskOne(&survey.Select{Message: "Select backup:", Options: options, PageSize: 12}, &choice)
+	if err != nil || choice == len(backups) {
+		return
+	}
+
+	printBackupDiff(detectedConfigPath, backups[choice])
+	fmt.Println()
+
+	confirm := false
+	survey.AskOne(&survey.Confirm{Message: "Restore this backup?"}, &confirm)
+	if !confirm {
+		return
+	}
+	if err := restoreConfigBackup(detectedConfigPath, backups[choice]); err != nil {
+		fmt.Println(red("Restore failed: "), err)
+		waitEnter()
+		return
+	}
+	fmt.Println(green("Config restored."))
+	restartServicePrompt()
+}
+
+// configCommand handles "ygglazy config ...".
+func configCommand(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: ygglazy config <backups|diff [N]|rollback [N]>")
+	}
+
+	backups, err := listConfigBackups(detectedConfigPath)
+	if err != nil {
+		return err
+	}
+
+	// Backups are numbered from 1, newest first
+	pick := func() (ConfigBackup, error) {
+		if len(backups) == 0 {
+			return ConfigBackup{}, fmt.Errorf("no backups found in %s", configBackupDir(detectedConfigPath))
+		}
+		n := 1
+		if len(args) > 1 {
+			var err error
+			n, err = strconv.Atoi(args[1])
+			if err != nil || n < 1 || n > len(backups) {
+				return ConfigBackup{}, fmt.Errorf("backup number must be between 1 and %d", len(backups))
+			}
+		}
+		return backups[n-1], nil
+	}
+
+	switch args[0] {
+	case "backups":
+		if len(backups) == 0 {
+			fmt.Println(yellow("No backups found."))
+			return nil
+		}
+		printBackupList(backups)
+		return nil
+	case "diff":
+		b, err := pick()
+		if err != nil {
+			return err
+		}
+		printBackupDiff(detectedConfigPath, b)
+		return nil
+	case "rollback":
+		b, err := pick()
+		if err != nil {
+			return err
+		}
+		printBackupList(backups)
+		fmt.Printf("\nRestoring backup from %s\n", b.Time.Format("2006-01-02 15:04:05"))
+		printBackupDiff(detectedConfigPath, b)
+		confirm := false
+		survey.AskOne(&survey.Confirm{Message: "Restore this backup?"}, &confirm)
+		if !confirm {
+			return nil
+		}
+		if err := restoreConfigBackup(detectedConfigPath, b); err != nil {
+			return err
+		}
+		fmt.Println(green("Config restored."))
+		restartServicePrompt()
+		return nil
+	}
+	return fmt.Errorf("unknown config command: %s", args[0])
+}
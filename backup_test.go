@@ -0,0 +1,46 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestWriteFileAtomicKeepsOwner(t *testing.T) {
+	if runtime.GOOS == "windows" || os.Geteuid() != 0 {
+		t.Skip("changing the owner of a file needs root")
+	}
+	path := filepath.Join(t.TempDir(), "yggdrasil.conf")
+	os.WriteFile(path, []byte("{}\n"), 0640)
+	if err := os.Chown(path, 0, 4242); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFileAtomic(path, []byte("{\n  IfMTU: 1280\n}\n"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uid, gid, _ := fileOwner(info); uid != 0 || gid != 4242 {
+		t.Errorf("owner after save = %d:%d, want 0:4242", uid, gid)
+	}
+	if info.Mode().Perm() != 0640 {
+		t.Errorf("mode after save = %v, want 0640", info.Mode().Perm())
+	}
+}
+
+func TestWriteFileAtomicNewFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "settings.json")
+	if err := writeFileAtomic(path, []byte("{}\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "{}\n" {
+		t.Errorf("wrote %q", data)
+	}
+	leftovers, _ := filepath.Glob(filepath.Join(filepath.Dir(path), ".*.tmp-*"))
+	if len(leftovers) > 0 {
+		t.Errorf("temp files left behind: %v", leftovers)
+	}
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// --- Peer List Cache ---
+
+// offlineMode makes every download come from the cache (--offline).
+var offlineMode bool
+
+// httpTimeout bounds a single request, body included; fetchTimeout bounds
+// loading every peer source.
+const (
+	httpTimeout  = 30 * time.Second
+	fetchTimeout = 2 * time.Minute
+)
+
+var httpClient = &http.Client{Timeout: httpTimeout}
+
+// downloadClient fetches installer packages, which can take a while.
+var downloadClient = &http.Client{Timeout: 15 * time.Minute}
+
+// CacheEntry is the metadata kept next to a cached response body.
+type CacheEntry struct {
+	URL          string    `json:"url"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	Fetched      time.Time `json:"fetched"` // Last time the server confirmed the body
+}
+
+// olderData combines the stale times of two downloads: the older one, where
+// zero means the data is fresh.
+func olderData(a, b time.Time) time.Time {
+	if a.IsZero() || !b.IsZero() && b.Before(a) {
+		return b
+	}
+	return a
+}
+
+// stateDir is where ygglazy keeps downloaded data, checked by privateDir.
+// There is no fallback such as /tmp: other users could plant peer lists
+// there, or a git checkout whose hooks would run as root.
+func stateDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("no cache directory: %v", err)
+	}
+	dir = filepath.Join(dir, "ygglazy")
+	return dir, privateDir(dir, true)
+}
+
+func httpCacheDir() (string, error) {
+	dir, err := stateDir()
+	return filepath.Join(dir, "http"), err
+}
+
+func cacheFiles(url string) (meta, body string, err error) {
+	sum := sha256.Sum256([]byte(url))
+	name := hex.EncodeToString(sum[:12])
+	dir, err := httpCacheDir()
+	return filepath.Join(dir, name+".json"), filepath.Join(dir, name+".body"), err
+}
+
+func readCache(url string) (*CacheEntry, []byte, bool) {
+	metaPath, bodyPath, err := cacheFiles(url)
+	if err != nil {
+		return nil, nil, false
+	}
+	data, err := os.ReadFile(metaPath)
+	if err != nil {
+		return nil, nil, false
+	}
+	var entry CacheEntry
+	if json.Unmarshal(data, &entry) != nil || entry.URL != url {
+		return nil, nil, false
+	}
+	body, err := os.ReadFile(bodyPath)
+	if err != nil {
+		return nil, nil, false
+	}
+	return &entry, body, true
+}
+
+func writeCache(entry *CacheEntry, body []byte) error {
+	metaPath, bodyPath, err := cacheFiles(entry.URL)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(metaPath), 0755); err != nil {
+		return err
+	}
+	if body != nil {
+		if err := writeFileAtomic(bodyPath, body, 0644); err != nil {
+			return err
+		}
+	}
+	data, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(metaPath, data, 0644)
+}
+
+// httpGet downloads a URL through the cache. Cached copies are revalidated
+// with ETag/If-Modified-Since; if the server can't be reached the cached
+// copy is used. In offline mode only the cache is consulted. stale is zero
+// for data the server sent or confirmed, and otherwise when the cached copy
+// was last confirmed, so the UI can say how old the list is.
+func httpGet(ctx context.Context, url string) (body []byte, stale time.Time, err error) {
+	entry, cached, haveCache := readCache(url)
+	if offlineMode {
+		if !haveCache {
+			return nil, time.Time{}, fmt.Errorf("%s: not cached (offline mode)", url)
+		}
+		return cached, entry.Fetched, nil
+	}
+
+	req, err := newRequest(ctx, url)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	if haveCache {
+		if entry.ETag != "" {
+			req.Header.Set("If-None-Match", entry.ETag)
+		}
+		if entry.LastModified != "" {
+			req.Header.Set("If-Modified-Since", entry.LastModified)
+		}
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		if haveCache && !errors.Is(err, context.Canceled) {
+			return cached, entry.Fetched, nil
+		}
+		return nil, time.Time{}, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && haveCache:
+		entry.Fetched = time.Now()
+		writeCache(entry, nil)
+		return cached, time.Time{}, nil
+	case resp.StatusCode == http.StatusOK:
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+		writeCache(&CacheEntry{
+			URL:          url,
+			ETag:         resp.Header.Get("ETag"),
+			LastModified: resp.Header.Get("Last-Modified"),
+			Fetched:      time.Now(),
+		}, body)
+		return body, time.Time{}, nil
+	}
+	err = responseError(resp)
+	var rateErr *RateLimitError
+	if haveCache && (resp.StatusCode >= 500 || errors.As(err, &rateErr)) {
+		return cached, entry.Fetched, nil
+	}
+	return nil, time.Time{}, err
+}
+
+// peerCacheUpdated returns when the cache was last refreshed, or zero if
+// it is empty.
+func peerCacheUpdated() time.Time {
+	var newest time.Time
+	dir, err := httpCacheDir()
+	if err != nil {
+		return newest
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			continue
+		}
+		var entry CacheEntry
+		if json.Unmarshal(data, &entry) == nil && entry.Fetched.After(newest) {
+			newest = entry.Fetched
+		}
+	}
+	return newest
+}
+
+// formatAge describes how long ago t was, e.g. "3h ago".
+func formatAge(t time.Time) string {
+	d := time.Since(t)
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		return fmt.Sprintf("%dm ago", int(d.Minutes()))
+	case d < 48*time.Hour:
+		return fmt.Sprintf("%dh ago", int(d.Hours()))
+	}
+	return fmt.Sprintf("%dd ago", int(d.Hours()/24))
+}
+
+func clearPeerCache() error {
+	state, err := stateDir()
+	if err != nil {
+		return err
+	}
+	for _, dir := range []string{filepath.Join(state, "http"), filepath.Join(state, "git")} {
+		if err := os.RemoveAll(dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStateDirPrivate(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no owner or mode bits on Windows")
+	}
+	isolateDirs(t)
+	dir, err := stateDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := os.Stat(dir); info.Mode().Perm() != 0700 {
+		t.Errorf("state dir created %v, want 0700", info.Mode().Perm())
+	}
+
+	// A planted, world-writable cache is never read
+	url := "https://example.org/peers.txt"
+	if err := writeCache(&CacheEntry{URL: url}, []byte("tls://planted.example:1")); err != nil {
+		t.Fatal(err)
+	}
+	os.Chmod(dir, 0777)
+	if _, _, ok := readCache(url); ok {
+		t.Error("readCache() read from a world-writable dir")
+	}
+	src := &GitMirrorSource{URL: "https://example.org/peers.git"}
+	if _, err := src.checkoutDir(); err == nil {
+		t.Error("checkoutDir() accepted a world-writable dir")
+	}
+	if err := clearPeerCache(); err == nil {
+		t.Error("clearPeerCache() removed files from a world-writable dir")
+	}
+	os.Chmod(dir, 0700)
+	if _, _, ok := readCache(url); !ok {
+		t.Error("readCache() missed the entry once the dir was private again")
+	}
+
+	t.Setenv("HOME", "")
+	t.Setenv("XDG_CACHE_HOME", "")
+	if dir, err := stateDir(); err == nil {
+		t.Errorf("stateDir() = %s without a cache dir, want an error", dir)
+	}
+	if _, _, ok := readCache(url); ok {
+		t.Error("readCache() found a cache without a cache dir")
+	}
+}
+
+func TestHTTPGetCache(t *testing.T) {
+	isolateDirs(t)
+	defer func(saved bool) { offlineMode = saved }(offlineMode)
+	offlineMode = false
+
+	var requests, notModified int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte("tls://a.example:443"))
+	}))
+	defer srv.Close()
+	url := srv.URL + "/peers.txt"
+
+	// 200, then 304 for the revalidated copy; both are fresh
+	for i := 0; i < 2; i++ {
+		body, stale, err := httpGet(context.Background(), url)
+		if err != nil || string(body) != "tls://a.example:443" || !stale.IsZero() {
+			t.Fatalf("httpGet() #%d = %q, %v, %v", i+1, body, stale, err)
+		}
+	}
+	if requests != 2 || notModified != 1 {
+		t.Fatalf("server saw %d requests, %d revalidated; want 2, 1", requests, notModified)
+	}
+	entry, _, _ := readCache(url)
+
+	// Offline hit: the cached copy, marked with when it was last confirmed
+	offlineMode = true
+	body, stale, err := httpGet(context.Background(), url)
+	if err != nil || string(body) != "tls://a.example:443" || !stale.Equal(entry.Fetched) {
+		t.Fatalf("offline httpGet() = %q, %v, %v; want the cache from %v", body, stale, err, entry.Fetched)
+	}
+	if requests != 2 {
+		t.Error("offline mode reached the server")
+	}
+
+	// Offline miss
+	if _, _, err := httpGet(context.Background(), srv.URL+"/other.txt"); err == nil || !strings.Contains(err.Error(), "not cached") {
+		t.Errorf("offline httpGet() of an uncached URL: error = %v", err)
+	}
+
+	// The server going away serves the cache, marked stale
+	offlineMode = false
+	srv.Close()
+	if body, stale, err := httpGet(context.Background(), url); err != nil || string(body) != "tls://a.example:443" || stale.IsZero() {
+		t.Errorf("httpGet() with the server down = %q, %v, %v", body, stale, err)
+	}
+	if _, _, err := httpGet(context.Background(), srv.URL+"/other.txt"); err == nil {
+		t.Error("httpGet() of an uncached URL with the server down succeeded")
+	}
+}
+
+func TestOlderData(t *testing.T) {
+	old, recent := time.Unix(100, 0), time.Unix(200, 0)
+	for _, tt := range []struct{ a, b, want time.Time }{
+		{time.Time{}, time.Time{}, time.Time{}},
+		{time.Time{}, recent, recent},
+		{recent, time.Time{}, recent},
+		{recent, old, old},
+		{old, recent, old},
+	} {
+		if got := olderData(tt.a, tt.b); !got.Equal(tt.want) {
+			t.Errorf("olderData(%v, %v) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// --- Config File ---
+
+// Config is a Yggdrasil config file loaded into a document model. All edits
+// made by the tool go through it, so unrelated keys and comments are kept.
+type Config struct {
+	Path   string
+	Doc    *Document
+	Backup string // Backup taken by the last Save, if any
+}
+
+func loadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := parseDocument(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return &Config{Path: path, Doc: doc}, nil
+}
+
+// Save validates the edited document, backs up the current file and
+// atomically replaces it, keeping the file permissions.
+func (c *Config) Save() error {
+	data := c.Doc.Encode()
+	prev, _ := os.ReadFile(c.Path)
+	if err := validateConfigData(data, prev); err != nil {
+		return fmt.Errorf("config not changed, validation failed: %v", err)
+	}
+
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(c.Path); err == nil {
+		mode = info.Mode().Perm()
+		backup, err := backupConfig(c.Path)
+		if err != nil {
+			return fmt.Errorf("backup failed, config not changed: %v", err)
+		}
+		c.Backup = backup
+		noteConfigBackup(backup)
+	}
+	return writeFileAtomic(c.Path, data, mode)
+}
+
+// Get returns a top-level config value, or nil if the key is missing.
+func (c *Config) Get(key string) *Node {
+	return c.Doc.Root.Member(key)
+}
+
+// Set replaces a top-level config value, keeping the comments above it.
+func (c *Config) Set(key string, value *Node) {
+	c.Doc.Root.SetMember(key, value)
+}
+
+// StringList returns a top-level array of strings such as Peers or Listen.
+func (c *Config) StringList(key string) []string {
+	return c.Get(key).Strings()
+}
+
+// SetStringList replaces a top-level array of strings. Items that are kept
+// keep their comments, so labels written next to them are not lost.
+func (c *Config) SetStringList(key string, values []string) {
+	c.Set(key, buildStringArray(c.Get(key), values))
+}
+
+// buildStringArray makes an array node for values, reusing the item nodes of
+// old (if any) so their comments survive.
+func buildStringArray(old *Node, values []string) *Node {
+	existing := make(map[string]*Node)
+	arr := newArrayNode()
+	if old != nil && old.Kind == NodeArray {
+		for _, item := range old.Children {
+			if item.Kind == NodeString {
+				existing[item.Value] = item
+			}
+		}
+		arr.Inner = old.Inner
+	}
+	for _, v := range values {
+		if item, ok := existing[v]; ok {
+			arr.Children = append(arr.Children, item)
+			delete(existing, v)
+			continue
+		}
+		arr.Children = append(arr.Children, newStringNode(v))
+	}
+	return arr
+}
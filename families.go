@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- Address Families ---
+
+// FamilyResult is how a peer did over one address family.
+type FamilyResult struct {
+	Family  string // "IPv6" or "IPv4"
+	Addrs   []net.IP
+	Latency time.Duration // Average of the successful probes
+	OK      int           // Successful probes
+	Tried   int
+	Skipped string // Why the family wasn't probed
+	Error   string // Last failure
+}
+
+// Summary is one line for the ranking, e.g. "IPv6 2001:db8::1: 42ms (5/5)".
+func (f FamilyResult) Summary() string {
+	addrs := make([]string, len(f.Addrs))
+	for i, ip := range f.Addrs {
+		addrs[i] = ip.String()
+	}
+	label := f.Family
+	if len(addrs) > 0 {
+		label += " " + truncate(strings.Join(addrs, ", "), 40)
+	}
+	switch {
+	case f.Skipped != "":
+		return fmt.Sprintf("%s: skipped, %s", label, f.Skipped)
+	case f.OK == 0:
+		return fmt.Sprintf("%s: unreachable (%s)", label, truncate(f.Error, 50))
+	}
+	return fmt.Sprintf("%s: %s (%d/%d)", label, f.Latency.Round(time.Millisecond), f.OK, f.Tried)
+}
+
+// HostFamilies says which address families this host can reach the
+// internet over.
+type HostFamilies struct {
+	IPv4, IPv6             bool
+	IPv4Reason, IPv6Reason string // Why a family is unusable
+}
+
+var (
+	hostFamiliesOnce sync.Once
+	hostFamilies     HostFamilies
+)
+
+// yggdrasilSubnet is the overlay's own range; a route into it says nothing
+// about the host's internet connectivity.
+var _, yggdrasilSubnet, _ = net.ParseCIDR("200::/7")
+
+// detectHostFamilies checks once per run for a route and a global source
+// address towards well-known public resolvers. UDP "connects" send nothing.
+func detectHostFamilies() HostFamilies {
+	hostFamiliesOnce.Do(func() {
+		hostFamilies.IPv4, hostFamilies.IPv4Reason = familyRoute("udp4", "8.8.8.8:53")
+		hostFamilies.IPv6, hostFamilies.IPv6Reason = familyRoute("udp6", "[2001:4860:4860::8888]:53")
+	})
+	return hostFamilies
+}
+
+func familyRoute(network, addr string) (bool, string) {
+	conn, err := net.Dial(network, addr)
+	if err != nil {
+		return false, "no route"
+	}
+	defer conn.Close()
+	local := conn.LocalAddr().(*net.UDPAddr).IP
+	if !local.IsGlobalUnicast() || yggdrasilSubnet.Contains(local) || (local.To4() == nil && local.IsPrivate()) {
+		return false, "no global address"
+	}
+	return true, ""
+}
+
+func (h HostFamilies) String() string {
+	mark := func(ok bool, reason string) string {
+		if ok {
+			return green("✓")
+		}
+		return red("✗") + " (" + reason + ")"
+	}
+	return fmt.Sprintf("IPv4 %s, IPv6 %s", mark(h.IPv4, h.IPv4Reason), mark(h.IPv6, h.IPv6Reason))
+}
+
+// familyGroups resolves a peer's host to all its A and AAAA records and
+// groups them by family, IPv6 first as Yggdrasil tries it first. Families
+// this host can't use are marked skipped. It returns nil for peers that
+// aren't dialled by address: unix sockets, and socks, whose proxy resolves.
+func familyGroups(ctx context.Context, p *PeerURI) ([]FamilyResult, error) {
+	if p.Scheme == "unix" || p.Scheme == "socks" || p.Scheme == "sockstls" {
+		return nil, nil
+	}
+	var ips []net.IP
+	if ip := net.ParseIP(p.Host); ip != nil {
+		ips = []net.IP{ip}
+	} else {
+		addrs, err := net.DefaultResolver.LookupIPAddr(ctx, p.Host)
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range addrs {
+			ips = append(ips, a.IP)
+		}
+	}
+
+	host := detectHostFamilies()
+	if !host.IPv4 && !host.IPv6 {
+		// Detection found nothing usable, so it can't be trusted here
+		host.IPv4, host.IPv6 = true, true
+	}
+	v6 := FamilyResult{Family: "IPv6"}
+	v4 := FamilyResult{Family: "IPv4"}
+	for _, ip := range ips {
+		if ip.To4() != nil {
+			v4.Addrs = append(v4.Addrs, ip)
+		} else {
+			v6.Addrs = append(v6.Addrs, ip)
+		}
+	}
+	if !host.IPv6 {
+		v6.Skipped = "no IPv6 on this host"
+	}
+	if !host.IPv4 {
+		v4.Skipped = "no IPv4 on this host"
+	}
+	var groups []FamilyResult
+	for _, g := range []FamilyResult{v6, v4} {
+		if len(g.Addrs) > 0 {
+			groups = append(groups, g)
+		}
+	}
+	return groups, nil
+}
+
+// targets returns one dialable copy of p per address of the family.
+func (f FamilyResult) targets(p *PeerURI) []*PeerURI {
+	out := make([]*PeerURI, len(f.Addrs))
+	for i, ip := range f.Addrs {
+		out[i] = p.withIP(ip)
+	}
+	return out
+}
@@ -0,0 +1,35 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// fileOwner returns the uid and gid a file belongs to.
+func fileOwner(info os.FileInfo) (uid, gid int, ok bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
+	}
+	return int(st.Uid), int(st.Gid), true
+}
+
+// checkPrivateDir makes sure nobody but this user can have put files in
+// dir: it must be ours and not writable by group or others. Our own 0755
+// directories from older versions are tightened to 0700.
+func checkPrivateDir(dir string, info os.FileInfo) error {
+	if uid, _, ok := fileOwner(info); ok && uid != os.Geteuid() {
+		return fmt.Errorf("%s belongs to uid %d, not to this user; refusing to use it", dir, uid)
+	}
+	if info.Mode().Perm()&0022 != 0 {
+		return fmt.Errorf("%s is writable by other users (%v); refusing to use it", dir, info.Mode().Perm())
+	}
+	if info.Mode().Perm() != 0700 {
+		return os.Chmod(dir, 0700)
+	}
+	return nil
+}
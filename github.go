@@ -0,0 +1,267 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// --- GitHub ---
+
+const (
+	defaultGitHubAPI   = "https://api.github.com"
+	defaultPeersBranch = "master"
+)
+
+// PeerRepo is the public-peers repository used by default: owner, name,
+// branch, and the API base for GitHub Enterprise or Gitea-compatible hosts.
+type PeerRepo struct {
+	Owner   string
+	Name    string
+	Branch  string
+	APIBase string
+}
+
+// peerRepo is resolved at startup from flags, environment and settings.
+var peerRepo = PeerRepo{Owner: repoOwner, Name: repoPeers, Branch: defaultPeersBranch, APIBase: defaultGitHubAPI}
+
+// peerRepoFlags are the command line overrides; empty fields are unset.
+var peerRepoFlags struct {
+	Repo, Branch, API string
+}
+
+// resolvePeerRepo applies, from lowest to highest precedence, the settings
+// file, YGGLAZY_PEERS_REPO/YGGLAZY_PEERS_BRANCH/YGGLAZY_GITHUB_API and flags.
+func resolvePeerRepo() error {
+	settings, err := loadSettings()
+	if err != nil {
+		return err
+	}
+	layers := []struct{ repo, branch, api string }{
+		{settings.PeersRepo, settings.PeersBranch, settings.GitHubAPI},
+		{os.Getenv("YGGLAZY_PEERS_REPO"), os.Getenv("YGGLAZY_PEERS_BRANCH"), os.Getenv("YGGLAZY_GITHUB_API")},
+		{peerRepoFlags.Repo, peerRepoFlags.Branch, peerRepoFlags.API},
+	}
+	for _, l := range layers {
+		if l.repo != "" {
+			owner, name, ok := strings.Cut(l.repo, "/")
+			if !ok || owner == "" || name == "" || strings.Contains(name, "/") {
+				return fmt.Errorf("peers repository must be owner/name, not %q", l.repo)
+			}
+			peerRepo.Owner, peerRepo.Name = owner, name
+		}
+		if l.branch != "" {
+			peerRepo.Branch = l.branch
+		}
+		if l.api != "" {
+			u, err := url.Parse(l.api)
+			if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+				return fmt.Errorf("API base must be an http(s) URL, not %q", l.api)
+			}
+			peerRepo.APIBase = strings.TrimSuffix(l.api, "/")
+		}
+	}
+	return nil
+}
+
+func (r PeerRepo) Spec() string {
+	return fmt.Sprintf("github:%s/%s@%s", r.Owner, r.Name, r.Branch)
+}
+
+// isDefaultAPI reports whether the API is github.com's, whose raw files and
+// archives are served from their own hosts.
+func (r PeerRepo) isDefaultAPI() bool {
+	return r.APIBase == defaultGitHubAPI
+}
+
+func defaultPeerSources() []string {
+	return []string{peerRepo.Spec()}
+}
+
+// RateLimitError is returned when GitHub refuses a request because the
+// client used up its request quota.
+type RateLimitError struct {
+	Limit         int
+	Reset         time.Time
+	Authenticated bool
+}
+
+func (e *RateLimitError) Error() string {
+	msg := "GitHub API rate limit exceeded"
+	if e.Limit > 0 {
+		msg += fmt.Sprintf(" (%d requests/hour)", e.Limit)
+	}
+	if !e.Reset.IsZero() {
+		msg += fmt.Sprintf("; resets at %s (in %s)", e.Reset.Format("15:04"), time.Until(e.Reset).Round(time.Minute))
+	}
+	if !e.Authenticated {
+		msg += ". Set GITHUB_TOKEN to raise the limit"
+	}
+	return msg
+}
+
+// isGitHubHost reports whether a URL is served by GitHub or the configured
+// API base, whose responses carry GitHub's rate limit and error format.
+func isGitHubHost(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	if api, err := url.Parse(peerRepo.APIBase); err == nil && u.Host == api.Host {
+		return true
+	}
+	return u.Host == "github.com" || strings.HasSuffix(u.Host, ".github.com") || u.Host == "raw.githubusercontent.com"
+}
+
+// apiToken returns the token to send to a host. GITHUB_TOKEN only goes to
+// github.com itself; the API base can come from a settings file, so a custom
+// one gets its own YGGLAZY_GITHUB_API_TOKEN.
+func apiToken(u *url.URL) string {
+	switch u.Host {
+	case "api.github.com", "github.com", "codeload.github.com":
+		return os.Getenv("GITHUB_TOKEN")
+	}
+	if api, err := url.Parse(peerRepo.APIBase); err == nil && !peerRepo.isDefaultAPI() && u.Host == api.Host {
+		return os.Getenv("YGGLAZY_GITHUB_API_TOKEN")
+	}
+	return ""
+}
+
+// newRequest builds a GET request with the token for its host, see apiToken.
+func newRequest(ctx context.Context, rawURL string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if token := apiToken(req.URL); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if isGitHubHost(rawURL) {
+		if strings.HasPrefix(req.URL.Host, "api.") {
+			req.Header.Set("Accept", "application/vnd.github+json")
+		}
+		if strings.Contains(req.URL.Path, "/contents/") {
+			req.Header.Set("Accept", "application/vnd.github.raw")
+		}
+	}
+	return req, nil
+}
+
+// responseError turns a failed response into an error, recognising GitHub
+// rate limiting and GitHub's JSON error messages.
+func responseError(resp *http.Response) error {
+	if isGitHubHost(resp.Request.URL.String()) {
+		limited := resp.StatusCode == http.StatusTooManyRequests ||
+			(resp.StatusCode == http.StatusForbidden && resp.Header.Get("X-RateLimit-Remaining") == "0")
+		if limited {
+			e := &RateLimitError{Authenticated: resp.Request.Header.Get("Authorization") != ""}
+			e.Limit, _ = strconv.Atoi(resp.Header.Get("X-RateLimit-Limit"))
+			if reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+				e.Reset = time.Unix(reset, 0)
+			} else if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+				e.Reset = time.Now().Add(time.Duration(secs) * time.Second)
+			}
+			return e
+		}
+		var body struct {
+			Message string `json:"message"`
+		}
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		if json.Unmarshal(data, &body) == nil && body.Message != "" {
+			return fmt.Errorf("GitHub: %s (%s)", body.Message, resp.Status)
+		}
+	}
+	return fmt.Errorf("%s: %s", resp.Request.URL, resp.Status)
+}
+
+func (s *GitHubSource) treeURL() string {
+	return fmt.Sprintf("%s/repos/%s/%s/git/trees/%s?recursive=1", peerRepo.APIBase, s.Owner, s.Repo, url.PathEscape(s.Branch))
+}
+
+// fileURL is where the raw content of a file in the repository is served.
+// Other hosts than github.com serve it through the contents API.
+func (s *GitHubSource) fileURL(path string) string {
+	if peerRepo.isDefaultAPI() {
+		return fmt.Sprintf("https://raw.githubusercontent.com/%s/%s/%s/%s", s.Owner, s.Repo, s.Branch, path)
+	}
+	return fmt.Sprintf("%s/repos/%s/%s/contents/%s?ref=%s", peerRepo.APIBase, s.Owner, s.Repo, path, url.QueryEscape(s.Branch))
+}
+
+// archiveURL is the tarball of a branch. On github.com it isn't counted
+// against the API rate limit.
+func (s *GitHubSource) archiveURL() string {
+	if peerRepo.isDefaultAPI() {
+		return fmt.Sprintf("https://github.com/%s/%s/archive/refs/heads/%s.tar.gz", s.Owner, s.Repo, s.Branch)
+	}
+	return fmt.Sprintf("%s/repos/%s/%s/tarball/%s", peerRepo.APIBase, s.Owner, s.Repo, url.PathEscape(s.Branch))
+}
+
+// decodeContents unwraps a contents API response (Gitea always answers in
+// JSON with base64 content); other bodies are returned unchanged.
+func decodeContents(body []byte) []byte {
+	var c struct {
+		Content  string `json:"content"`
+		Encoding string `json:"encoding"`
+	}
+	if json.Unmarshal(body, &c) != nil || c.Encoding != "base64" {
+		return body
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(c.Content, "\n", ""))
+	if err != nil {
+		return body
+	}
+	return data
+}
+
+// loadArchive reads every peer list from the branch tarball in one request.
+func (s *GitHubSource) loadArchive(ctx context.Context) ([]PeerCandidate, time.Time, error) {
+	body, stale, err := httpGet(ctx, s.archiveURL())
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	gz, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("reading archive: %v", err)
+	}
+	tr := tar.NewReader(gz)
+	var out []PeerCandidate
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, time.Time{}, fmt.Errorf("reading archive: %v", err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		// Entries are "<repo>-<branch>/<region>/<country>.md"
+		parts := strings.Split(hdr.Name, "/")
+		if len(parts) < 3 || !isPeerListFile(hdr.Name) {
+			continue
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, time.Time{}, fmt.Errorf("reading archive: %v", err)
+		}
+		rel := strings.Join(parts[1:], "/")
+		out = append(out, recordCandidates(parsePeerMarkdown(parts[1], rel, string(data)))...)
+	}
+	if len(out) == 0 {
+		return nil, time.Time{}, fmt.Errorf("no peer lists found in %s", s.archiveURL())
+	}
+	return out, stale, nil
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestAPIToken(t *testing.T) {
+	t.Setenv("GITHUB_TOKEN", "gh")
+	t.Setenv("YGGLAZY_GITHUB_API_TOKEN", "custom")
+	saved := peerRepo
+	defer func() { peerRepo = saved }()
+
+	tests := []struct {
+		api, url, want string
+	}{
+		{defaultGitHubAPI, "https://api.github.com/repos/o/r/git/trees/master", "gh"},
+		{defaultGitHubAPI, "https://github.com/o/r/archive/refs/heads/master.tar.gz", "gh"},
+		{defaultGitHubAPI, "https://codeload.github.com/o/r/tar.gz/refs/heads/master", "gh"},
+		{defaultGitHubAPI, "https://raw.githubusercontent.com/o/r/master/europe/germany.md", ""},
+		{defaultGitHubAPI, "https://evil.github.com.example/x", ""},
+		{"https://git.example.org/api/v1", "https://git.example.org/api/v1/repos/o/r/git/trees/main", "custom"},
+		{"https://git.example.org/api/v1", "https://api.github.com/repos/o/r/git/trees/main", "gh"},
+		{"https://git.example.org/api/v1", "https://peers.example.net/list.txt", ""},
+	}
+	for _, tt := range tests {
+		peerRepo.APIBase = tt.api
+		u, _ := url.Parse(tt.url)
+		if got := apiToken(u); got != tt.want {
+			t.Errorf("apiToken(%s) with API %s = %q, want %q", tt.url, tt.api, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// --- Yggdrasil Handshake ---
+
+// Protocol version this tool checks peers against (Yggdrasil 0.5.x).
+const (
+	protocolMajor uint16 = 0
+	protocolMinor uint16 = 5
+)
+
+// Metadata fields sent when a link comes up.
+const (
+	metaVersionMajor uint16 = iota
+	metaVersionMinor
+	metaPublicKey
+	metaPriority
+)
+
+// LinkMeta is what a Yggdrasil node announces as soon as a link is open.
+type LinkMeta struct {
+	Major     uint16
+	Minor     uint16
+	PublicKey ed25519.PublicKey
+	Priority  uint8
+}
+
+func (m *LinkMeta) Version() string {
+	return fmt.Sprintf("%d.%d", m.Major, m.Minor)
+}
+
+// Compatible reports whether the node speaks our protocol version. Nodes
+// only peer when both major and minor versions match.
+func (m *LinkMeta) Compatible() bool {
+	return m.Major == protocolMajor && m.Minor == protocolMinor
+}
+
+func (m *LinkMeta) KeyHex() string {
+	return hex.EncodeToString(m.PublicKey)
+}
+
+// NotYggdrasilError means something answered on the port but didn't
+// complete the Yggdrasil handshake.
+type NotYggdrasilError struct {
+	Reason string
+}
+
+func (e *NotYggdrasilError) Error() string {
+	return "not a compatible Yggdrasil node: " + e.Reason
+}
+
+// errUnverifiable is returned for link types the handshake can't be run
+// over here: socks dials a proxy, which would be checked instead of the peer.
+var errUnverifiable = errors.New("handshake can't be checked over this link type")
+
+// readLinkMeta reads and checks a node's metadata: "meta", a 2-byte length,
+// TLV fields, then an ed25519 signature over the BLAKE2b-512 hash of the
+// public key, keyed with the link password.
+func readLinkMeta(r io.Reader, password []byte) (*LinkMeta, error) {
+	var head [6]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		return nil, &NotYggdrasilError{Reason: fmt.Sprintf("no metadata received (%v)", err)}
+	}
+	if !bytes.Equal(head[:4], []byte("meta")) {
+		return nil, &NotYggdrasilError{Reason: fmt.Sprintf("unexpected preamble %q", head[:4])}
+	}
+	// Before 0.5 the version bytes followed the preamble directly
+	if head[4] == 0 && head[5] < 5 {
+		return nil, &NotYggdrasilError{Reason: fmt.Sprintf("incompatible protocol 0.%d", head[5])}
+	}
+	length := binary.BigEndian.Uint16(head[4:6])
+	if length < ed25519.SignatureSize {
+		return nil, &NotYggdrasilError{Reason: "metadata too short"}
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, &NotYggdrasilError{Reason: fmt.Sprintf("truncated metadata (%v)", err)}
+	}
+	sig := body[len(body)-ed25519.SignatureSize:]
+	fields := body[:len(body)-ed25519.SignatureSize]
+
+	m := &LinkMeta{}
+	for len(fields) >= 4 {
+		op := binary.BigEndian.Uint16(fields[:2])
+		n := int(binary.BigEndian.Uint16(fields[2:4]))
+		fields = fields[4:]
+		if len(fields) < n {
+			break
+		}
+		value := fields[:n]
+		fields = fields[n:]
+		switch {
+		case op == metaVersionMajor && n == 2:
+			m.Major = binary.BigEndian.Uint16(value)
+		case op == metaVersionMinor && n == 2:
+			m.Minor = binary.BigEndian.Uint16(value)
+		case op == metaPublicKey && n == ed25519.PublicKeySize:
+			m.PublicKey = ed25519.PublicKey(append([]byte(nil), value...))
+		case op == metaPriority && n == 1:
+			m.Priority = value[0]
+		}
+	}
+	if m.PublicKey == nil {
+		return nil, &NotYggdrasilError{Reason: "metadata has no public key"}
+	}
+	if !m.Compatible() {
+		return m, &NotYggdrasilError{Reason: "incompatible protocol " + m.Version()}
+	}
+	h, err := blake2b.New512(password)
+	if err != nil {
+		return m, fmt.Errorf("link password: %v", err)
+	}
+	h.Write(m.PublicKey)
+	if !ed25519.Verify(m.PublicKey, h.Sum(nil), sig) {
+		reason := "bad metadata signature"
+		if len(password) == 0 {
+			reason += " (the peer may need ?password=)"
+		}
+		return m, &NotYggdrasilError{Reason: reason}
+	}
+	return m, nil
+}
+
+// verifyYggdrasil opens a link the way a node would and reads the remote's
+// metadata. Nodes send theirs first, so nothing is sent and the link is
+// dropped before it becomes a peering. Dial failures are returned as is;
+// anything wrong after the link is open is a *NotYggdrasilError.
+func verifyYggdrasil(ctx context.Context, p *PeerURI, timeout time.Duration) (*LinkMeta, error) {
+	var conn net.Conn
+	var err error
+	switch p.Scheme {
+	case "tcp", "unix":
+		conn, _, err = dialTCP(ctx, p, timeout)
+	case "tls":
+		conn, _, err = dialTLS(ctx, p, timeout)
+	case "quic":
+		conn, _, err = dialQUIC(ctx, p, timeout)
+	case "ws", "wss":
+		conn, _, err = dialWS(ctx, p, p.Scheme == "wss", timeout)
+		if err == nil {
+			conn = &wsFrameConn{Conn: conn}
+		}
+	default:
+		return nil, errUnverifiable
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	return readLinkMeta(conn, []byte(p.Password()))
+}
+
+// wsFrameConn reads the payload of binary WebSocket frames, which is how
+// Yggdrasil carries its stream over ws:// and wss://.
+type wsFrameConn struct {
+	net.Conn
+	remaining uint64
+}
+
+func (c *wsFrameConn) Read(b []byte) (int, error) {
+	for c.remaining == 0 {
+		var head [2]byte
+		if _, err := io.ReadFull(c.Conn, head[:]); err != nil {
+			return 0, err
+		}
+		opcode := head[0] & 0x0f
+		length := uint64(head[1] & 0x7f)
+		switch length {
+		case 126:
+			var ext [2]byte
+			if _, err := io.ReadFull(c.Conn, ext[:]); err != nil {
+				return 0, err
+			}
+			length = uint64(binary.BigEndian.Uint16(ext[:]))
+		case 127:
+			var ext [8]byte
+			if _, err := io.ReadFull(c.Conn, ext[:]); err != nil {
+				return 0, err
+			}
+			length = binary.BigEndian.Uint64(ext[:])
+		}
+		if head[1]&0x80 != 0 {
+			return 0, fmt.Errorf("WebSocket: server sent a masked frame")
+		}
+		switch opcode {
+		case 0x0, 0x2: // Continuation, binary
+			c.remaining = length
+		case 0x8:
+			return 0, io.EOF
+		default: // Text and control frames carry no link data
+			if _, err := io.CopyN(io.Discard, c.Conn, int64(length)); err != nil {
+				return 0, err
+			}
+		}
+	}
+	if uint64(len(b)) > c.remaining {
+		b = b[:c.remaining]
+	}
+	n, err := c.Conn.Read(b)
+	c.remaining -= uint64(n)
+	return n, err
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/binary"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"golang.org/x/crypto/blake2b"
+)
+
+// testKey is a fixed node identity for the metadata tests.
+var testKey = ed25519.NewKeyFromSeed(bytes.Repeat([]byte{7}, ed25519.SeedSize))
+
+// encodeLinkMeta builds a metadata frame the way yggdrasil-go's
+// version_metadata.encode does.
+func encodeLinkMeta(t *testing.T, major, minor uint16, priv ed25519.PrivateKey, password string) []byte {
+	t.Helper()
+	pub := priv.Public().(ed25519.PublicKey)
+	bs := []byte("meta")
+	bs = append(bs, 0, 0) // Length, filled in below
+	field := func(op uint16, value []byte) {
+		bs = binary.BigEndian.AppendUint16(bs, op)
+		bs = binary.BigEndian.AppendUint16(bs, uint16(len(value)))
+		bs = append(bs, value...)
+	}
+	field(metaVersionMajor, binary.BigEndian.AppendUint16(nil, major))
+	field(metaVersionMinor, binary.BigEndian.AppendUint16(nil, minor))
+	field(metaPublicKey, pub)
+	field(metaPriority, []byte{3})
+	h, err := blake2b.New512([]byte(password))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.Write(pub)
+	bs = append(bs, ed25519.Sign(priv, h.Sum(nil))...)
+	binary.BigEndian.PutUint16(bs[4:6], uint16(len(bs)-6))
+	return bs
+}
+
+func TestReadLinkMeta(t *testing.T) {
+	valid := encodeLinkMeta(t, 0, 5, testKey, "")
+	badSig := append([]byte(nil), valid...)
+	badSig[len(badSig)-1] ^= 0xff
+	other := ed25519.NewKeyFromSeed(bytes.Repeat([]byte{9}, ed25519.SeedSize))
+	// Another node's signature on our key's frame
+	forged := append(encodeLinkMeta(t, 0, 5, testKey, "")[:len(valid)-ed25519.SignatureSize],
+		encodeLinkMeta(t, 0, 5, other, "")[len(valid)-ed25519.SignatureSize:]...)
+
+	tests := []struct {
+		name     string
+		frame    []byte
+		password string
+		wantErr  string
+	}{
+		{name: "valid", frame: valid},
+		{name: "valid with password", frame: encodeLinkMeta(t, 0, 5, testKey, "hunter2"), password: "hunter2"},
+		{name: "bad signature", frame: badSig, wantErr: "bad metadata signature (the peer may need ?password=)"},
+		{name: "signed by another key", frame: forged, wantErr: "bad metadata signature"},
+		{name: "wrong password", frame: encodeLinkMeta(t, 0, 5, testKey, "hunter2"), password: "hunter3", wantErr: "bad metadata signature"},
+		{name: "password missing", frame: encodeLinkMeta(t, 0, 5, testKey, "hunter2"), wantErr: "the peer may need ?password="},
+		{name: "password not expected", frame: valid, password: "hunter2", wantErr: "bad metadata signature"},
+		{name: "password too long", frame: valid, password: strings.Repeat("x", 65), wantErr: "link password"},
+		{name: "empty", frame: nil, wantErr: "no metadata received"},
+		{name: "header only", frame: valid[:6], wantErr: "truncated metadata"},
+		{name: "truncated body", frame: valid[:len(valid)-10], wantErr: "truncated metadata"},
+		{name: "truncated preamble", frame: valid[:3], wantErr: "no metadata received"},
+		{name: "http answer", frame: []byte("HTTP/1.1 400 Bad Request\r\n\r\n"), wantErr: `unexpected preamble "HTTP"`},
+		{name: "ssh banner", frame: []byte("SSH-2.0-OpenSSH_9.6\r\n"), wantErr: `unexpected preamble "SSH-"`},
+		{name: "0.4 node", frame: append([]byte("meta\x00\x04"), make([]byte, 40)...), wantErr: "incompatible protocol 0.4"},
+		{name: "0.6 node", frame: encodeLinkMeta(t, 0, 6, testKey, ""), wantErr: "incompatible protocol 0.6"},
+		{name: "too short", frame: append([]byte("meta"), 0, 10), wantErr: "metadata too short"},
+		{name: "no public key", frame: append([]byte("meta\x00\x40"), make([]byte, 64)...), wantErr: "metadata has no public key"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := readLinkMeta(bytes.NewReader(tt.frame), []byte(tt.password))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("readLinkMeta() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !m.PublicKey.Equal(testKey.Public()) || m.Version() != "0.5" || m.Priority != 3 {
+				t.Errorf("readLinkMeta() = key %s, version %s, priority %d", m.KeyHex(), m.Version(), m.Priority)
+			}
+		})
+	}
+}
+
+func TestVerifyYggdrasil(t *testing.T) {
+	frame := encodeLinkMeta(t, 0, 5, testKey, "")
+	node := listenTCP(t, func(conn net.Conn) {
+		defer conn.Close()
+		conn.Write(frame)
+		time.Sleep(time.Second)
+	})
+	quicNode := listenQUIC(t, func(s *quic.Stream) {
+		s.Write(frame)
+		time.Sleep(time.Second)
+	})
+	quicWeb := listenQUIC(t, func(s *quic.Stream) {
+		s.Write([]byte("HTTP/1.1 200 OK\r\n\r\n"))
+		time.Sleep(time.Second)
+	})
+	web := listenTCP(t, func(conn net.Conn) {
+		defer conn.Close()
+		conn.Write([]byte("HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n"))
+	})
+
+	tests := []struct {
+		name, uri string
+		wantErr   string
+	}{
+		{"yggdrasil node", "tcp://" + node, ""},
+		{"web server", "tcp://" + web, `unexpected preamble "HTTP"`},
+		{"silent port", "tcp://" + listenTCP(t, silent), "no metadata received"},
+		{"quic node", "quic://" + quicNode, ""},
+		{"quic server", "quic://" + quicWeb, `unexpected preamble "HTTP"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := parsePeerURI(tt.uri)
+			if err != nil {
+				t.Fatal(err)
+			}
+			m, err := verifyYggdrasil(context.Background(), p, 500*time.Millisecond)
+			if tt.wantErr == "" {
+				if err != nil || !m.PublicKey.Equal(testKey.Public()) {
+					t.Fatalf("verifyYggdrasil() = %v, %v", m, err)
+				}
+				return
+			}
+			var notYgg *NotYggdrasilError
+			if !errors.As(err, &notYgg) || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("verifyYggdrasil() error = %v, want a NotYggdrasilError with %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	p, _ := parsePeerURI("socks://127.0.0.1:1080/peer.example:1")
+	if _, err := verifyYggdrasil(context.Background(), p, time.Second); !errors.Is(err, errUnverifiable) {
+		t.Errorf("verifyYggdrasil(socks) error = %v, want errUnverifiable", err)
+	}
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// --- Config Validation & Service Health ---
+
+const (
+	windowsDaemonExe     = `C:\Program Files\Yggdrasil\yggdrasil.exe`
+	linuxDaemonExe       = "yggdrasil"
+	serviceHealthTimeout = 30 * time.Second
+)
+
+// lastGoodConfig is a backup of the config as it was at the last successful
+// restart: the first backup taken by a change after it. It is restored
+// automatically if the service does not come back after a restart, so
+// several edits in a row roll back to a config known to work.
+var lastGoodConfig string
+
+// noteConfigBackup records a backup taken before a change, see lastGoodConfig.
+func noteConfigBackup(backup string) {
+	if lastGoodConfig == "" {
+		lastGoodConfig = backup
+	}
+}
+
+// yggdrasilctl talks to the admin endpoint in the config's AdminListen.
+func yggdrasilctl(args ...string) *exec.Cmd {
+	cmdName := linuxExe
+	if isWindows {
+		cmdName = windowsExe
+	}
+	if endpoint, _ := adminEndpoint(); endpoint != "" {
+		args = append([]string{"-endpoint", endpoint}, args...)
+	}
+	return exec.Command(cmdName, args...)
+}
+
+// adminEndpoint returns the config's AdminListen, or "" when it is missing
+// and yggdrasil uses its default. enabled is false for "none".
+func adminEndpoint() (endpoint string, enabled bool) {
+	cfg, err := loadConfig(detectedConfigPath)
+	if err != nil {
+		return "", true
+	}
+	node := cfg.Get("AdminListen")
+	if node == nil {
+		return "", true
+	}
+	switch v := strings.TrimSpace(node.Str()); v {
+	case "", "none":
+		return "", false
+	default:
+		return v, true
+	}
+}
+
+func yggdrasilDaemonPath() (string, bool) {
+	if isWindows {
+		return windowsDaemonExe, fileExists(windowsDaemonExe)
+	}
+	path, err := exec.LookPath(linuxDaemonExe)
+	return path, err == nil
+}
+
+// validateConfigData checks an edited config before it is written. It always
+// runs the internal schema check, and also asks the yggdrasil binary to
+// normalise the config when one is installed. prev is the config before the
+// edit, or nil: peer URIs already in it are left to yggdrasil to judge, so a
+// URI this tool can't parse doesn't block unrelated edits.
+func validateConfigData(data, prev []byte) error {
+	doc, err := parseDocument(data)
+	if err != nil {
+		return err
+	}
+	known := map[string]bool{}
+	if prevDoc, err := parseDocument(prev); prev != nil && err == nil {
+		known = configPeerURIs(prevDoc.Root)
+	}
+	if err := checkConfigSchema(doc.Root, known); err != nil {
+		return err
+	}
+
+	daemon, ok := yggdrasilDaemonPath()
+	if !ok {
+		return nil
+	}
+	tmp, err := os.CreateTemp("", "ygglazy-check-*.conf")
+	if err != nil {
+		return nil
+	}
+	defer os.Remove(tmp.Name())
+	tmp.Write(data)
+	tmp.Close()
+
+	out, err := exec.Command(daemon, "-useconffile", tmp.Name(), "-normaliseconf").CombinedOutput()
+	if err != nil {
+		msg := strings.TrimSpace(string(out))
+		if msg == "" {
+			msg = err.Error()
+		}
+		return fmt.Errorf("yggdrasil rejected the config: %s", msg)
+	}
+	return nil
+}
+
+// configPeerURIs collects the URIs in Peers and InterfacePeers.
+func configPeerURIs(root *Node) map[string]bool {
+	uris := map[string]bool{}
+	for _, uri := range root.Member("Peers").Strings() {
+		uris[uri] = true
+	}
+	if n := root.Member("InterfacePeers"); n != nil && n.Kind == NodeObject {
+		for _, iface := range n.Children {
+			for _, uri := range iface.Strings() {
+				uris[uri] = true
+			}
+		}
+	}
+	return uris
+}
+
+// checkConfigSchema verifies the types of the keys the tool knows about.
+// Peer URIs in known were there before the edit and aren't parsed.
+func checkConfigSchema(root *Node, known map[string]bool) error {
+	expectKind := func(key string, kind NodeKind, name string) (*Node, error) {
+		n := root.Member(key)
+		if n == nil {
+			return nil, nil
+		}
+		if n.Kind != kind {
+			return nil, fmt.Errorf("%s must be %s", key, name)
+		}
+		return n, nil
+	}
+	stringItems := func(key string, n *Node) error {
+		for _, item := range n.Children {
+			if item.Kind != NodeString {
+				return fmt.Errorf("%s must only contain strings", key)
+			}
+		}
+		return nil
+	}
+
+	if n, err := expectKind("PrivateKey", NodeString, "a hex string"); err != nil {
+		return err
+	} else if n != nil {
+		if b, err := hex.DecodeString(n.Value); err != nil || len(b) != 64 {
+			return fmt.Errorf("PrivateKey must be 128 hex characters")
+		}
+	}
+
+	for _, key := range []string{"Peers", "Listen", "AllowedPublicKeys"} {
+		n, err := expectKind(key, NodeArray, "a list")
+		if err != nil {
+			return err
+		}
+		if n == nil {
+			continue
+		}
+		if err := stringItems(key, n); err != nil {
+			return err
+		}
+	}
+	for _, uri := range root.Member("Peers").Strings() {
+		if _, err := parsePeerURI(uri); err != nil && !known[uri] {
+			return fmt.Errorf("Peers: %v", err)
+		}
+	}
+	for _, key := range root.Member("AllowedPublicKeys").Strings() {
+		if b, err := hex.DecodeString(key); err != nil || len(b) != 32 {
+			return fmt.Errorf("invalid key in AllowedPublicKeys: %s", key)
+		}
+	}
+
+	if n, err := expectKind("InterfacePeers", NodeObject, "a map of interface names to lists"); err != nil {
+		return err
+	} else if n != nil {
+		for _, iface := range n.Children {
+			if iface.Kind != NodeArray {
+				return fmt.Errorf("InterfacePeers.%s must be a list", iface.Key)
+			}
+			if err := stringItems("InterfacePeers."+iface.Key, iface); err != nil {
+				return err
+			}
+			for _, uri := range iface.Strings() {
+				if _, err := parsePeerURI(uri); err != nil && !known[uri] {
+					return fmt.Errorf("InterfacePeers.%s: %v", iface.Key, err)
+				}
+			}
+		}
+	}
+
+	if n, err := expectKind("MulticastInterfaces", NodeArray, "a list"); err != nil {
+		return err
+	} else if n != nil {
+		for _, item := range n.Children {
+			if item.Kind != NodeObject {
+				return fmt.Errorf("MulticastInterfaces must only contain objects")
+			}
+		}
+	}
+
+	if _, err := expectKind("IfMTU", NodeNumber, "a number"); err != nil {
+		return err
+	}
+	if _, err := expectKind("NodeInfoPrivacy", NodeBool, "true or false"); err != nil {
+		return err
+	}
+	return nil
+}
+
+// serviceHealthy reports whether the admin API answers or, with the admin
+// API disabled, whether the service manager has the service running.
+func serviceHealthy() bool {
+	if _, enabled := adminEndpoint(); !enabled {
+		return currentPlatform.ServiceRunning()
+	}
+	out, err := yggdrasilctl("-json", "getSelf").Output()
+	if err != nil {
+		return false
+	}
+	var self map[string]interface{}
+	return json.Unmarshal(out, &self) == nil
+}
+
+// waitForService polls serviceHealthy until the service answers or the
+// timeout passes. The service state alone is a weaker sign than an admin
+// API answer, so it has to hold for a few seconds in a row.
+func waitForService(timeout time.Duration) bool {
+	need := 1
+	if _, enabled := adminEndpoint(); !enabled {
+		need = 3
+	}
+	deadline := time.Now().Add(timeout)
+	for healthy := 0; ; {
+		if serviceHealthy() {
+			healthy++
+			if healthy >= need {
+				return true
+			}
+		} else {
+			healthy = 0
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		fmt.Print(".")
+		time.Sleep(time.Second)
+	}
+}
+
+// restartAndVerify restarts the service and waits for it to come up. If it
+// does not, the config from the last successful restart is restored and the
+// service is restarted once more.
+func restartAndVerify() {
+	data, err := os.ReadFile(detectedConfigPath)
+	if err == nil {
+		// Nothing is being edited here, only yggdrasil's verdict counts
+		err = validateConfigData(data, data)
+	}
+	if err != nil {
+		fmt.Println(red("Config is invalid, not restarting: "), err)
+		return
+	}
+
+	if err := currentPlatform.ManageService("Restart"); err != nil {
+		fmt.Println(red("Restart failed: "), err)
+	}
+
+	if _, enabled := adminEndpoint(); !enabled {
+		fmt.Println(yellow("The admin API is off (AdminListen: none), so only the service state is checked."))
+	}
+	fmt.Print("Waiting for Yggdrasil to come up")
+	if waitForService(serviceHealthTimeout) {
+		fmt.Println()
+		fmt.Println(green("Service restarted and responding."))
+		lastGoodConfig = ""
+		return
+	}
+	fmt.Println()
+	fmt.Println(red("Service did not respond within " + serviceHealthTimeout.String() + "."))
+
+	if lastGoodConfig == "" || !fileExists(lastGoodConfig) {
+		fmt.Println(yellow("No backup of the previous config to restore. Check the service logs."))
+		return
+	}
+	fmt.Println(yellow("Restoring the config from before the last changes..."))
+	err = restoreConfigBackup(detectedConfigPath, ConfigBackup{Path: lastGoodConfig})
+	lastGoodConfig = "" // Don't roll back the rollback
+	if err != nil {
+		fmt.Println(red("Restore failed: "), err)
+		return
+	}
+	if err := currentPlatform.ManageService("Restart"); err != nil {
+		fmt.Println(red("Restart failed: "), err)
+	}
+	fmt.Print("Waiting for Yggdrasil to come up")
+	if waitForService(serviceHealthTimeout) {
+		fmt.Println()
+		fmt.Println(green("Previous config restored and service is responding."))
+	} else {
+		fmt.Println()
+		fmt.Println(red("Service is still down with the previous config. Check the service logs."))
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateConfigDataPeers(t *testing.T) {
+	t.Setenv("PATH", "") // Only the local check, no yggdrasil binary
+	prev := []byte(`{
+  Peers: ["future://a.example:1"]
+  InterfacePeers: {eth0: ["tcp://b.example:2"]}
+}`)
+	tests := []struct {
+		name, data, wantErr string
+	}{
+		{"existing unknown URI kept", `{Peers: ["future://a.example:1"], IfMTU: 1280}`, ""},
+		{"valid URI added", `{Peers: ["future://a.example:1", "tls://c.example:443"]}`, ""},
+		{"unknown URI added", `{Peers: ["future://a.example:1", "other://c.example:1"]}`, `Peers: invalid peer URI "other://c.example:1"`},
+		{"unknown interface URI added", `{InterfacePeers: {eth0: ["tcp://b.example:2", "bad://d"]}}`, `InterfacePeers.eth0: invalid peer URI "bad://d"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateConfigData([]byte(tt.data), prev)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("validateConfigData() error = %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Fatalf("validateConfigData() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+	if err := validateConfigData(prev, nil); err == nil {
+		t.Error("validateConfigData() without a previous config accepted an unknown scheme")
+	}
+}
+
+func TestAdminEndpoint(t *testing.T) {
+	saved := detectedConfigPath
+	defer func() { detectedConfigPath = saved }()
+	dir := t.TempDir()
+	tests := []struct {
+		config, endpoint string
+		enabled          bool
+	}{
+		{`{IfMTU: 1280}`, "", true},
+		{"AdminListen: unix:///var/run/yggdrasil.sock\n", "unix:///var/run/yggdrasil.sock", true},
+		{`{AdminListen: "tcp://localhost:9001"}`, "tcp://localhost:9001", true},
+		{"AdminListen: none\n", "", false},
+		{`{AdminListen: ""}`, "", false},
+	}
+	for i, tt := range tests {
+		detectedConfigPath = filepath.Join(dir, fmt.Sprintf("%d.conf", i))
+		os.WriteFile(detectedConfigPath, []byte(tt.config), 0600)
+		if endpoint, enabled := adminEndpoint(); endpoint != tt.endpoint || enabled != tt.enabled {
+			t.Errorf("adminEndpoint() for %s = %q, %v, want %q, %v", tt.config, endpoint, enabled, tt.endpoint, tt.enabled)
+		}
+	}
+	args := yggdrasilctl("getSelf").Args
+	if got := strings.Join(args[1:], " "); got != "getSelf" {
+		t.Errorf("yggdrasilctl() with the admin API off = %q", got)
+	}
+	detectedConfigPath = filepath.Join(dir, "2.conf")
+	args = yggdrasilctl("-json", "getSelf").Args
+	if got := strings.Join(args[1:], " "); got != "-endpoint tcp://localhost:9001 -json getSelf" {
+		t.Errorf("yggdrasilctl() = %q", got)
+	}
+}
+
+// Several edits without a restart roll back to the config from before the
+// first of them, not to one that may be just as broken.
+func TestLastGoodConfig(t *testing.T) {
+	t.Setenv("PATH", "")
+	saved := lastGoodConfig
+	defer func() { lastGoodConfig = saved }()
+	lastGoodConfig = ""
+
+	path := filepath.Join(t.TempDir(), "yggdrasil.conf")
+	os.WriteFile(path, []byte("{\n  IfMTU: 1280\n}\n"), 0600)
+	for _, mtu := range []int{1400, 1500} {
+		cfg, err := loadConfig(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg.Set("IfMTU", newNumberNode(mtu))
+		if err := cfg.Save(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, err := os.ReadFile(lastGoodConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "1280") {
+		t.Errorf("rollback target holds %q, want the config before both edits", data)
+	}
+}
@@ -0,0 +1,667 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// --- HJSON Document Model ---
+//
+// Yggdrasil reads its config with hjson-go, so a config may be HJSON (comments,
+// quoteless keys and strings, optional commas) or plain JSON. The parser below
+// keeps every comment, blank line and key in the order it was found, so that a
+// document can be edited in place and written back without losing anything.
+
+type NodeKind int
+
+const (
+	NodeNull NodeKind = iota
+	NodeBool
+	NodeNumber
+	NodeString
+	NodeArray
+	NodeObject
+)
+
+// Node is a single value of a config document together with its comments.
+type Node struct {
+	Kind     NodeKind
+	Key      string   // Member name when the node lives in an object
+	Value    string   // String contents, or the literal text of a number/bool
+	Children []*Node  // Object members or array items, in document order
+	Comments []string // Comment lines before the node ("" is a blank line)
+	Trailing string   // Comment on the same line after the value
+	Inner    []string // Comments after the last child, before the closing bracket
+}
+
+// Document is a parsed config file.
+type Document struct {
+	Root   *Node
+	JSON   bool     // Source was plain JSON, so it is written back as JSON
+	Braces bool     // Root object had explicit braces
+	Footer []string // Comments after the root object
+}
+
+func newStringNode(value string) *Node {
+	return &Node{Kind: NodeString, Value: value}
+}
+
+func newBoolNode(value bool) *Node {
+	return &Node{Kind: NodeBool, Value: strconv.FormatBool(value)}
+}
+
+func newNumberNode(value int) *Node {
+	return &Node{Kind: NodeNumber, Value: strconv.Itoa(value)}
+}
+
+func newArrayNode() *Node {
+	return &Node{Kind: NodeArray}
+}
+
+func newObjectNode() *Node {
+	return &Node{Kind: NodeObject}
+}
+
+// Member returns the object member with the given key, or nil.
+func (n *Node) Member(key string) *Node {
+	if n == nil || n.Kind != NodeObject {
+		return nil
+	}
+	for _, c := range n.Children {
+		if c.Key == key {
+			return c
+		}
+	}
+	return nil
+}
+
+// SetMember replaces the value of an existing member while keeping its
+// comments, or appends a new member to the end of the object.
+func (n *Node) SetMember(key string, value *Node) {
+	value.Key = key
+	for i, c := range n.Children {
+		if c.Key == key {
+			if len(value.Comments) == 0 {
+				value.Comments = c.Comments
+			}
+			if value.Trailing == "" {
+				value.Trailing = c.Trailing
+			}
+			n.Children[i] = value
+			return
+		}
+	}
+	n.Children = append(n.Children, value)
+}
+
+// RemoveMember deletes a member from the object.
+func (n *Node) RemoveMember(key string) {
+	for i, c := range n.Children {
+		if c.Key == key {
+			n.Children = append(n.Children[:i], n.Children[i+1:]...)
+			return
+		}
+	}
+}
+
+// Bool returns the value of a bool node, or def if n is not a bool.
+func (n *Node) Bool(def bool) bool {
+	if n == nil || n.Kind != NodeBool {
+		return def
+	}
+	return n.Value == "true"
+}
+
+// Int returns the value of a number node, or def if n is not an integer.
+func (n *Node) Int(def int) int {
+	if n == nil || n.Kind != NodeNumber {
+		return def
+	}
+	v, err := strconv.Atoi(n.Value)
+	if err != nil {
+		return def
+	}
+	return v
+}
+
+// Str returns the value of a string node, or "" if n is not a string.
+func (n *Node) Str() string {
+	if n == nil || n.Kind != NodeString {
+		return ""
+	}
+	return n.Value
+}
+
+// Strings returns the string items of an array node.
+func (n *Node) Strings() []string {
+	var out []string
+	if n == nil || n.Kind != NodeArray {
+		return out
+	}
+	for _, c := range n.Children {
+		if c.Kind == NodeString {
+			out = append(out, c.Value)
+		}
+	}
+	return out
+}
+
+// --- Parser ---
+
+type hjsonParser struct {
+	src  []byte
+	pos  int
+	json bool // Stays true while the input is strict JSON
+}
+
+var (
+	literalRe      = regexp.MustCompile(`^(true|false|null|-?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][+-]?[0-9]+)?)[ \t]*(,|\]|\}|#|//|/\*|\r?\n|$)`)
+	quotelessKeyRe = regexp.MustCompile(`^[A-Za-z0-9_\-\.]+$`)
+)
+
+func parseDocument(data []byte) (*Document, error) {
+	p := &hjsonParser{src: data, json: true}
+	doc := &Document{}
+
+	// Skip a UTF-8 BOM if the file was written by a Windows editor
+	p.src = bytes.TrimPrefix(p.src, []byte("\xef\xbb\xbf"))
+
+	header := p.skipSpace(true)
+	if !p.eof() && p.src[p.pos] == '{' {
+		p.pos++
+		doc.Braces = true
+		root := newObjectNode()
+		if err := p.parseMembers(root, '}'); err != nil {
+			return nil, err
+		}
+		root.Comments = header
+		doc.Root = root
+		doc.Footer = p.skipSpace(false)
+		if !p.eof() {
+			return nil, p.errorf("unexpected %q after root object", p.src[p.pos])
+		}
+	} else {
+		// HJSON allows the root braces to be omitted
+		p.json = false
+		p.pos = 0
+		root := newObjectNode()
+		if err := p.parseMembers(root, 0); err != nil {
+			return nil, err
+		}
+		doc.Root = root
+	}
+	doc.JSON = p.json
+	return doc, nil
+}
+
+func (p *hjsonParser) eof() bool {
+	return p.pos >= len(p.src)
+}
+
+func (p *hjsonParser) errorf(format string, args ...interface{}) error {
+	line := 1 + bytes.Count(p.src[:p.pos], []byte("\n"))
+	return fmt.Errorf("config line %d: %s", line, fmt.Sprintf(format, args...))
+}
+
+// skipSpace skips whitespace and comments, returning the comments found.
+// Blank lines are returned as empty strings so they survive a rewrite.
+func (p *hjsonParser) skipSpace(atLineStart bool) []string {
+	var comments []string
+	blank := atLineStart
+	for !p.eof() {
+		c := p.src[p.pos]
+		switch {
+		case c == '\n':
+			if blank {
+				comments = append(comments, "")
+			}
+			blank = true
+			p.pos++
+		case c == ' ' || c == '\t' || c == '\r':
+			p.pos++
+		case c == '#' || p.hasPrefix("//") || p.hasPrefix("/*"):
+			comments = append(comments, p.readComment())
+			blank = false
+		default:
+			return comments
+		}
+	}
+	return comments
+}
+
+func (p *hjsonParser) hasPrefix(s string) bool {
+	return bytes.HasPrefix(p.src[p.pos:], []byte(s))
+}
+
+func (p *hjsonParser) readComment() string {
+	p.json = false
+	start := p.pos
+	if p.hasPrefix("/*") {
+		end := bytes.Index(p.src[p.pos+2:], []byte("*/"))
+		if end == -1 {
+			p.pos = len(p.src)
+		} else {
+			p.pos += end + 4
+		}
+		return string(p.src[start:p.pos])
+	}
+	for !p.eof() && p.src[p.pos] != '\n' {
+		p.pos++
+	}
+	return strings.TrimRight(string(p.src[start:p.pos]), " \t\r")
+}
+
+// skipInline skips spaces on the current line only.
+func (p *hjsonParser) skipInline() {
+	for !p.eof() && (p.src[p.pos] == ' ' || p.src[p.pos] == '\t' || p.src[p.pos] == '\r') {
+		p.pos++
+	}
+}
+
+// peekSignificant returns the next non-whitespace byte without consuming it.
+func (p *hjsonParser) peekSignificant() byte {
+	for i := p.pos; i < len(p.src); i++ {
+		switch p.src[i] {
+		case ' ', '\t', '\r', '\n':
+			continue
+		}
+		return p.src[i]
+	}
+	return 0
+}
+
+// finishItem consumes the separator and same-line comment after a value.
+func (p *hjsonParser) finishItem(n *Node, closing byte) {
+	p.skipInline()
+	sawComma := false
+	if !p.eof() && p.src[p.pos] == ',' {
+		p.pos++
+		sawComma = true
+		p.skipInline()
+	}
+	if !p.eof() && (p.src[p.pos] == '#' || p.hasPrefix("//") || p.hasPrefix("/*")) {
+		n.Trailing = p.readComment()
+	}
+	// JSON needs a comma between items and none before the closing bracket
+	if sawComma == (p.peekSignificant() == closing) {
+		p.json = false
+	}
+}
+
+func (p *hjsonParser) parseMembers(obj *Node, closing byte) error {
+	for {
+		pending := p.skipSpace(false)
+		if p.eof() {
+			if closing != 0 {
+				return p.errorf("unexpected end of config, missing %q", closing)
+			}
+			obj.Inner = pending
+			return nil
+		}
+		if p.src[p.pos] == closing {
+			p.pos++
+			obj.Inner = pending
+			return nil
+		}
+		key, err := p.parseKey()
+		if err != nil {
+			return err
+		}
+		p.skipInline()
+		if p.eof() || p.src[p.pos] != ':' {
+			return p.errorf("expected ':' after key %q", key)
+		}
+		p.pos++
+		pending = append(pending, p.skipSpace(false)...)
+		value, err := p.parseValue()
+		if err != nil {
+			return err
+		}
+		value.Key = key
+		value.Comments = pending
+		p.finishItem(value, closing)
+		obj.Children = append(obj.Children, value)
+	}
+}
+
+func (p *hjsonParser) parseItems(arr *Node) error {
+	for {
+		pending := p.skipSpace(false)
+		if p.eof() {
+			return p.errorf("unexpected end of config, missing ']'")
+		}
+		if p.src[p.pos] == ']' {
+			p.pos++
+			arr.Inner = pending
+			return nil
+		}
+		value, err := p.parseValue()
+		if err != nil {
+			return err
+		}
+		value.Comments = pending
+		p.finishItem(value, ']')
+		arr.Children = append(arr.Children, value)
+	}
+}
+
+func (p *hjsonParser) parseKey() (string, error) {
+	if p.src[p.pos] == '"' || p.src[p.pos] == '\'' {
+		return p.parseQuoted()
+	}
+	p.json = false
+	start := p.pos
+	for !p.eof() && !strings.ContainsRune(" \t\r\n,:[]{}", rune(p.src[p.pos])) {
+		p.pos++
+	}
+	if p.pos == start {
+		return "", p.errorf("expected key, found %q", p.src[p.pos])
+	}
+	return string(p.src[start:p.pos]), nil
+}
+
+func (p *hjsonParser) parseValue() (*Node, error) {
+	if p.eof() {
+		return nil, p.errorf("unexpected end of config, expected value")
+	}
+	switch c := p.src[p.pos]; {
+	case c == '{':
+		p.pos++
+		n := newObjectNode()
+		return n, p.parseMembers(n, '}')
+	case c == '[':
+		p.pos++
+		n := newArrayNode()
+		return n, p.parseItems(n)
+	case p.hasPrefix("'''"):
+		return p.parseMultiline()
+	case c == '"' || c == '\'':
+		s, err := p.parseQuoted()
+		return newStringNode(s), err
+	case c == ',' || c == ':' || c == ']' || c == '}':
+		return nil, p.errorf("unexpected %q", c)
+	}
+
+	// Literal or quoteless string running to the end of the line
+	if m := literalRe.FindSubmatch(p.src[p.pos:]); m != nil {
+		lit := string(m[1])
+		p.pos += len(lit)
+		switch lit {
+		case "true", "false":
+			return &Node{Kind: NodeBool, Value: lit}, nil
+		case "null":
+			return &Node{Kind: NodeNull, Value: lit}, nil
+		}
+		return &Node{Kind: NodeNumber, Value: lit}, nil
+	}
+	p.json = false
+	start := p.pos
+	for !p.eof() && p.src[p.pos] != '\n' {
+		p.pos++
+	}
+	return newStringNode(strings.TrimRight(string(p.src[start:p.pos]), " \t\r")), nil
+}
+
+func (p *hjsonParser) parseQuoted() (string, error) {
+	quote := p.src[p.pos]
+	if quote == '\'' {
+		p.json = false
+	}
+	start := p.pos
+	p.pos++
+	for !p.eof() {
+		switch p.src[p.pos] {
+		case '\\':
+			p.pos += 2
+			continue
+		case '\n':
+			return "", p.errorf("unterminated string")
+		case quote:
+			p.pos++
+			s, err := unescapeHJSON(string(p.src[start+1 : p.pos-1]))
+			if err != nil {
+				return "", p.errorf("invalid string: %v", err)
+			}
+			return s, nil
+		}
+		p.pos++
+	}
+	return "", p.errorf("unterminated string")
+}
+
+// unescapeHJSON resolves the escapes of a quoted string. hjson-go takes the
+// same set in single and double quotes, \' included.
+func unescapeHJSON(s string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		if i == len(s) {
+			return "", fmt.Errorf("backslash at end of string")
+		}
+		switch c := s[i]; c {
+		case '"', '\'', '\\', '/':
+			b.WriteByte(c)
+		case 'b':
+			b.WriteByte('\b')
+		case 'f':
+			b.WriteByte('\f')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 't':
+			b.WriteByte('\t')
+		case 'u':
+			r, err := hexRune(s[i+1:])
+			if err != nil {
+				return "", err
+			}
+			i += 4
+			// Characters outside the BMP come as a UTF-16 surrogate pair
+			if utf16.IsSurrogate(r) && strings.HasPrefix(s[i+1:], `\u`) {
+				if r2, err := hexRune(s[i+3:]); err == nil {
+					if pair := utf16.DecodeRune(r, r2); pair != utf8.RuneError {
+						r = pair
+						i += 6
+					}
+				}
+			}
+			b.WriteRune(r)
+		default:
+			return "", fmt.Errorf("unknown escape \\%c", c)
+		}
+	}
+	return b.String(), nil
+}
+
+// hexRune reads the four hex digits of a \u escape.
+func hexRune(s string) (rune, error) {
+	if len(s) < 4 {
+		return 0, fmt.Errorf("short \\u escape")
+	}
+	n, err := strconv.ParseUint(s[:4], 16, 16)
+	if err != nil {
+		return 0, fmt.Errorf("invalid \\u escape %q", s[:4])
+	}
+	return rune(n), nil
+}
+
+// parseMultiline reads an HJSON triple-quoted block, stripping the
+// indentation of the opening quotes from every line as hjson-go does.
+func (p *hjsonParser) parseMultiline() (*Node, error) {
+	p.json = false
+	lineStart := bytes.LastIndexByte(p.src[:p.pos], '\n') + 1
+	indent := p.pos - lineStart
+	p.pos += 3
+	end := bytes.Index(p.src[p.pos:], []byte("'''"))
+	if end == -1 {
+		return nil, p.errorf("unterminated multiline string")
+	}
+	body := string(p.src[p.pos : p.pos+end])
+	p.pos += end + 3
+
+	body = strings.TrimLeft(body, " \t")
+	body = strings.TrimPrefix(body, "\n")
+	lines := strings.Split(body, "\n")
+	for i, l := range lines {
+		for j := 0; j < indent && strings.HasPrefix(l, " "); j++ {
+			l = l[1:]
+		}
+		lines[i] = l
+	}
+	value := strings.Join(lines, "\n")
+	value = strings.TrimRight(value, " \t")
+	value = strings.TrimSuffix(value, "\n")
+	return newStringNode(value), nil
+}
+
+// --- Writer ---
+
+// Encode serialises the document, as HJSON or JSON depending on its source.
+func (d *Document) Encode() []byte {
+	var b bytes.Buffer
+	if d.JSON {
+		writeJSON(&b, d.Root, 0)
+		b.WriteString("\n")
+		return b.Bytes()
+	}
+
+	if d.Braces {
+		writeComments(&b, d.Root.Comments, 0)
+		b.WriteString("{\n")
+		writeMembers(&b, d.Root, 1)
+		b.WriteString("}\n")
+		writeComments(&b, d.Footer, 0)
+	} else {
+		writeMembers(&b, d.Root, 0)
+	}
+	return b.Bytes()
+}
+
+func writeIndent(b *bytes.Buffer, level int) {
+	b.WriteString(strings.Repeat("  ", level))
+}
+
+func writeComments(b *bytes.Buffer, comments []string, level int) {
+	for _, c := range comments {
+		if c != "" {
+			writeIndent(b, level)
+			b.WriteString(c)
+		}
+		b.WriteString("\n")
+	}
+}
+
+func writeMembers(b *bytes.Buffer, n *Node, level int) {
+	for _, c := range n.Children {
+		writeComments(b, c.Comments, level)
+		writeIndent(b, level)
+		if n.Kind == NodeObject {
+			b.WriteString(encodeKey(c.Key))
+			b.WriteString(": ")
+		}
+		if c.Kind == NodeString && c.Trailing != "" {
+			// A quoteless string would swallow the comment that follows it
+			b.WriteString(encodeJSONString(c.Value))
+		} else {
+			writeValue(b, c, level)
+		}
+		if c.Trailing != "" {
+			b.WriteString(" ")
+			b.WriteString(c.Trailing)
+		}
+		b.WriteString("\n")
+	}
+	writeComments(b, n.Inner, level)
+}
+
+func writeValue(b *bytes.Buffer, n *Node, level int) {
+	switch n.Kind {
+	case NodeObject, NodeArray:
+		open, close := "{", "}"
+		if n.Kind == NodeArray {
+			open, close = "[", "]"
+		}
+		if len(n.Children) == 0 && len(n.Inner) == 0 {
+			b.WriteString(open + close)
+			return
+		}
+		b.WriteString(open + "\n")
+		writeMembers(b, n, level+1)
+		writeIndent(b, level)
+		b.WriteString(close)
+	case NodeString:
+		b.WriteString(encodeHJSONString(n.Value))
+	default:
+		b.WriteString(n.Value)
+	}
+}
+
+func encodeKey(key string) string {
+	if quotelessKeyRe.MatchString(key) {
+		return key
+	}
+	return encodeJSONString(key)
+}
+
+// encodeHJSONString writes a string quoteless when hjson-go would read it
+// back unchanged, and as a JSON string otherwise.
+func encodeHJSONString(s string) string {
+	if s == "" || s != strings.TrimSpace(s) || strings.ContainsAny(s, "\n\r\t") ||
+		strings.ContainsAny(s[:1], `{}[],:"'#`) || strings.HasPrefix(s, "//") ||
+		strings.HasPrefix(s, "/*") || literalRe.MatchString(s) {
+		return encodeJSONString(s)
+	}
+	return s
+}
+
+func encodeJSONString(s string) string {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+func writeJSON(b *bytes.Buffer, n *Node, level int) {
+	switch n.Kind {
+	case NodeObject, NodeArray:
+		open, close := "{", "}"
+		if n.Kind == NodeArray {
+			open, close = "[", "]"
+		}
+		if len(n.Children) == 0 {
+			b.WriteString(open + close)
+			return
+		}
+		b.WriteString(open + "\n")
+		for i, c := range n.Children {
+			writeIndent(b, level+1)
+			if n.Kind == NodeObject {
+				b.WriteString(encodeJSONString(c.Key))
+				b.WriteString(": ")
+			}
+			writeJSON(b, c, level+1)
+			if i < len(n.Children)-1 {
+				b.WriteString(",")
+			}
+			b.WriteString("\n")
+		}
+		writeIndent(b, level)
+		b.WriteString(close)
+	case NodeString:
+		b.WriteString(encodeJSONString(n.Value))
+	default:
+		b.WriteString(n.Value)
+	}
+}
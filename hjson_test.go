@@ -0,0 +1,87 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseQuoted(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{`"plain"`, "plain"},
+		{`"say \"hi\""`, `say "hi"`},
+		{`'say \"hi\"'`, `say "hi"`},
+		{`'say "hi"'`, `say "hi"`},
+		{`'it\'s'`, "it's"},
+		{`"it\'s"`, "it's"},
+		{`'a\\b\/c'`, `a\b/c`},
+		{`'tab\there\nnext'`, "tab\there\nnext"},
+		{`'café 🌐'`, "café 🌐"},
+		{`"\u00e9\ud83c\udf10"`, "é🌐"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			doc, err := parseDocument([]byte("{\n  v: " + tt.in + "\n}\n"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := doc.Root.Member("v").Str(); got != tt.want {
+				t.Errorf("parsed %q, want %q", got, tt.want)
+			}
+		})
+	}
+	for _, bad := range []string{`'\x'`, `"\u12"`, `'\uzzzz'`, `'open`} {
+		if _, err := parseDocument([]byte("v: " + bad + "\n")); err == nil {
+			t.Errorf("%s parsed without an error", bad)
+		}
+	}
+}
+
+// A commented HJSON config is written back byte for byte, and an edited one
+// reads back as what was written.
+func TestHJSONRoundTrip(t *testing.T) {
+	const config = `# Generated by yggdrasil -genconf
+{
+  # Outbound peers
+  Peers: [
+    tls://a.example:443
+    "tcp://b.example:80" # Backup
+  ]
+
+  /* Per-interface peers */
+  InterfacePeers: {}
+  Listen: []
+  AdminListen: unix:///var/run/yggdrasil.sock
+  IfName: auto
+  IfMTU: 65535
+  NodeInfoPrivacy: false
+  NodeInfo: {
+    name: it's "mine"
+    "key with spaces": "#not a comment"
+  }
+  // Last words
+}
+`
+	doc, err := parseDocument([]byte(config))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.JSON {
+		t.Fatal("HJSON config taken for JSON")
+	}
+	if got := string(doc.Encode()); got != config {
+		t.Fatalf("Encode() changed the config:\n%s", got)
+	}
+
+	doc.Root.Member("Peers").Children = append(doc.Root.Member("Peers").Children, newStringNode(`quic://c.example:1?sni='x'`))
+	doc.Root.Member("NodeInfo").SetMember("motto", newStringNode(`'quoted' "both" \ ways`))
+	doc.Root.SetMember("IfName", newStringNode("null"))
+	again, err := parseDocument(doc.Encode())
+	if err != nil {
+		t.Fatalf("edited config doesn't parse: %v\n%s", err, doc.Encode())
+	}
+	if !reflect.DeepEqual(again.Root, doc.Root) {
+		t.Errorf("edited config reads back differently:\n%s", doc.Encode())
+	}
+}
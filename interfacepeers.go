@@ -0,0 +1,203 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/AlecAivazis/survey/v2"
+	"github.com/AlecAivazis/survey/v2/terminal"
+)
+
+// --- Interface Peers ---
+
+const globalPeersOption = "Global (Peers)"
+
+// ConfiguredPeer is a peer from the config together with the list it lives
+// in: Interface is empty for the global Peers list, or the interface name
+// for an entry of InterfacePeers.
+type ConfiguredPeer struct {
+	URI       string
+	Interface string
+}
+
+func (p ConfiguredPeer) Label() string {
+	if p.Interface == "" {
+		return p.URI
+	}
+	return fmt.Sprintf("%s [%s]", p.URI, p.Interface)
+}
+
+// PeerList returns the global Peers list, or the InterfacePeers list of iface.
+func (c *Config) PeerList(iface string) []string {
+	if iface == "" {
+		return c.StringList("Peers")
+	}
+	return c.Get("InterfacePeers").Member(iface).Strings()
+}
+
+// SetPeerList replaces the global Peers list or the list of one interface.
+// An interface whose list becomes empty is dropped from InterfacePeers.
+func (c *Config) SetPeerList(iface string, peers []string) {
+	if iface == "" {
+		c.SetStringList("Peers", peers)
+		return
+	}
+	ifacePeers := c.Get("InterfacePeers")
+	if ifacePeers == nil || ifacePeers.Kind != NodeObject {
+		ifacePeers = newObjectNode()
+		c.Set("InterfacePeers", ifacePeers)
+	}
+	if len(peers) == 0 {
+		ifacePeers.RemoveMember(iface)
+		return
+	}
+	ifacePeers.SetMember(iface, buildStringArray(ifacePeers.Member(iface), peers))
+}
+
+// PeerInterfaces returns the interface names used in InterfacePeers.
+func (c *Config) PeerInterfaces() []string {
+	var names []string
+	if n := c.Get("InterfacePeers"); n != nil {
+		for _, child := range n.Children {
+			names = append(names, child.Key)
+		}
+	}
+	return names
+}
+
+// AllPeers returns the global peers followed by every interface peer.
+func (c *Config) AllPeers() []ConfiguredPeer {
+	var out []ConfiguredPeer
+	for _, uri := range c.PeerList("") {
+		out = append(out, ConfiguredPeer{URI: uri})
+	}
+	for _, iface := range c.PeerInterfaces() {
+		for _, uri := range c.PeerList(iface) {
+			out = append(out, ConfiguredPeer{URI: uri, Interface: iface})
+		}
+	}
+	return out
+}
+
+func getAllConfigPeers() []ConfiguredPeer {
+	cfg, err := loadConfig(detectedConfigPath)
+	if err != nil {
+		return nil
+	}
+	return cfg.AllPeers()
+}
+
+// hostInterfaceNames returns the names of the host's non-loopback interfaces.
+func hostInterfaceNames() []string {
+	var names []string
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return names
+	}
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		names = append(names, iface.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// askPeerTarget asks which list new peers should go to. It returns "" for
+// the global Peers list, or an interface name.
+func askPeerTarget(message string) (string, bool) {
+	options := []string{globalPeersOption}
+	seen := map[string]bool{}
+	for _, name := range hostInterfaceNames() {
+		options = append(options, name)
+		seen[name] = true
+	}
+
+	// Interfaces already used in the config may be down or renamed right now
+	if cfg, err := loadConfig(detectedConfigPath); err == nil {
+		for _, name := range cfg.PeerInterfaces() {
+			if !seen[name] {
+				options = append(options, name+" (not present)")
+			}
+		}
+	}
+	options = append(options, "Cancel")
+
+	choice := ""
+	err := survey.AskOne(&survey.Select{Message: message, Options: options, Default: globalPeersOption}, &choice)
+	if err != nil || choice == "Cancel" {
+		return "", false
+	}
+	if choice == globalPeersOption {
+		return "", true
+	}
+	return strings.TrimSuffix(choice, " (not present)"), true
+}
+
+// movePeerMenu moves peers between the global list and interface lists.
+func movePeerMenu() {
+	cfg, err := loadConfig(detectedConfigPath)
+	if err != nil {
+		fmt.Println(red("Error: "), err)
+		waitEnter()
+		return
+	}
+	all := cfg.AllPeers()
+	if len(all) == 0 {
+		fmt.Println(yellow("No peers in config."))
+		waitEnter()
+		return
+	}
+
+	labels := []string{}
+	for _, p := range all {
+		labels = append(labels, p.Label())
+	}
+	var picked []int
+	err = survey.AskOne(&survey.MultiSelect{Message: "Select peers to move:", Options: labels}, &picked)
+	if err == terminal.InterruptErr || len(picked) == 0 {
+		return
+	}
+
+	target, ok := askPeerTarget("Move to:")
+	if !ok {
+		return
+	}
+
+	for _, i := range picked {
+		p := all[i]
+		if p.Interface == target {
+			continue
+		}
+		var keep []string
+		for _, uri := range cfg.PeerList(p.Interface) {
+			if uri != p.URI {
+				keep = append(keep, uri)
+			}
+		}
+		cfg.SetPeerList(p.Interface, keep)
+
+		dest := cfg.PeerList(target)
+		isDup := false
+		for _, uri := range dest {
+			if samePeer(uri, p.URI) {
+				isDup = true
+				break
+			}
+		}
+		if !isDup {
+			cfg.SetPeerList(target, append(dest, p.URI))
+		}
+	}
+
+	if err := cfg.Save(); err != nil {
+		fmt.Println(red("Failed to update config: "), err)
+		waitEnter()
+		return
+	}
+	fmt.Println(green("Peers moved."))
+	restartServicePrompt()
+}
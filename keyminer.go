@@ -0,0 +1,266 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"os/signal"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/AlecAivazis/survey/v2"
+)
+
+// --- Key Miner ---
+
+var addrPrefixRe = regexp.MustCompile(`^2[0-9a-f:]*$`)
+
+// MineTarget is what the miner looks for: at least MinOnes leading one bits,
+// and/or an address whose text form starts with Prefix.
+type MineTarget struct {
+	MinOnes int
+	Prefix  string
+}
+
+func (t MineTarget) Match(addr []byte, text string) bool {
+	if int(addr[1]) < t.MinOnes {
+		return false
+	}
+	return t.Prefix == "" || strings.HasPrefix(text, t.Prefix)
+}
+
+func (t MineTarget) String() string {
+	var parts []string
+	if t.MinOnes > 0 {
+		parts = append(parts, fmt.Sprintf("strength >= %d", t.MinOnes))
+	}
+	if t.Prefix != "" {
+		parts = append(parts, "prefix "+t.Prefix)
+	}
+	return strings.Join(parts, " and ")
+}
+
+// ExpectedTries estimates how many keys have to be generated for one match.
+// The first group of the address is 0x02 followed by the number of leading
+// ones, which shows up with probability 2^-(n+1); every further hex digit of
+// the prefix is a 1 in 16 chance.
+func (t MineTarget) ExpectedTries() float64 {
+	tries := math.Pow(2, float64(t.MinOnes))
+	if t.Prefix == "" {
+		return tries
+	}
+	groups := strings.Split(t.Prefix, ":")
+	if len(groups[0]) == 3 || len(groups) > 1 {
+		ones, _ := strconv.ParseUint(strings.TrimPrefix(groups[0], "2"), 16, 8)
+		if int(ones) < t.MinOnes {
+			return math.Inf(1)
+		}
+		tries = math.Pow(2, float64(ones)+1)
+	} else if len(groups[0]) == 2 {
+		// "21" means a strength of 16-31, and so on
+		high, _ := strconv.ParseUint(groups[0][1:], 16, 8)
+		tries = math.Max(tries, math.Pow(2, float64(16*high)))
+	}
+	digits := len(strings.Join(groups[1:], ""))
+	return tries * math.Pow(16, float64(digits))
+}
+
+func parseMineTarget(ones int, prefix string) (MineTarget, error) {
+	prefix = strings.ToLower(strings.TrimSpace(prefix))
+	if prefix != "" && !addrPrefixRe.MatchString(prefix) {
+		return MineTarget{}, fmt.Errorf("prefix must be the start of a 200::/7 address, e.g. 201:cafe")
+	}
+	groups := strings.Split(prefix, ":")
+	if prefix != "" && len(groups[0]) > 3 {
+		return MineTarget{}, fmt.Errorf("the first group of the prefix has at most 3 digits, e.g. 20c")
+	}
+	// Every address starts with a full 2xx group, so "20:abc" can never match
+	if len(groups) > 1 && len(groups[0]) != 3 {
+		return MineTarget{}, fmt.Errorf("the first group of an address always has 3 digits, e.g. 20c:%s", strings.Join(groups[1:], ":"))
+	}
+	for _, g := range groups[1:] {
+		if len(g) > 4 || (len(g) > 1 && g[0] == '0') {
+			return MineTarget{}, fmt.Errorf("write groups the way addresses are shown: at most 4 digits, no leading zeros")
+		}
+	}
+	if ones < 0 || ones > 64 {
+		return MineTarget{}, fmt.Errorf("strength must be between 0 and 64")
+	}
+	t := MineTarget{MinOnes: ones, Prefix: prefix}
+	if t.MinOnes == 0 && t.Prefix == "" {
+		return t, fmt.Errorf("set a minimum strength or an address prefix")
+	}
+	if math.IsInf(t.ExpectedTries(), 1) {
+		return t, fmt.Errorf("prefix %s contradicts strength %d", prefix, ones)
+	}
+	return t, nil
+}
+
+func formatDuration(seconds float64) string {
+	if math.IsInf(seconds, 0) || seconds > 100*365*24*3600 {
+		return "centuries"
+	}
+	return time.Duration(seconds * float64(time.Second)).Round(time.Second).String()
+}
+
+// mineKey generates keys on every core until one matches the target or the
+// user presses Ctrl-C. It returns nil when interrupted.
+func mineKey(t MineTarget) ed25519.PrivateKey {
+	workers := runtime.NumCPU()
+	expected := t.ExpectedTries()
+	fmt.Printf("Mining for %s on %d cores (~%.0f keys expected). Ctrl-C to stop.\n", t, workers, expected)
+
+	var tries atomic.Uint64
+	var best atomic.Uint32
+	found := make(chan ed25519.PrivateKey, 1)
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				pub, priv, err := ed25519.GenerateKey(nil)
+				if err != nil {
+					continue
+				}
+				tries.Add(1)
+				addr := addrForKey(pub)
+				for {
+					b := best.Load()
+					if uint32(addr[1]) <= b || best.CompareAndSwap(b, uint32(addr[1])) {
+						break
+					}
+				}
+				if t.Match(addr, addr.String()) {
+					select {
+					case found <- priv:
+					default:
+					}
+					return
+				}
+			}
+		}()
+	}
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	start := time.Now()
+
+	var result ed25519.PrivateKey
+loop:
+	for {
+		select {
+		case result = <-found:
+			break loop
+		case <-interrupt:
+			break loop
+		case <-ticker.C:
+			elapsed := time.Since(start).Seconds()
+			n := float64(tries.Load())
+			rate := n / elapsed
+			eta := "?"
+			if rate > 0 {
+				eta = formatDuration(math.Max(expected-n, 0) / rate)
+			}
+			fmt.Printf("\r%.0f keys, %.0f keys/s, best strength %d, ETA %s      ", n, rate, best.Load(), eta)
+		}
+	}
+	close(stop)
+	wg.Wait()
+	fmt.Printf("\nTried %d keys in %s.\n", tries.Load(), time.Since(start).Round(time.Second))
+	return result
+}
+
+// offerMinedKey lets the user install or save a key the miner found.
+func offerMinedKey(priv ed25519.PrivateKey) error {
+	fmt.Println(green("\nFound a matching key:"))
+	printIdentity(priv)
+	for {
+		action := ""
+		err := survey.AskOne(&survey.Select{
+			Message: "What to do with it?",
+			Options: []string{"Install Into Config", "Save Encrypted Backup", "Discard"},
+		}, &action)
+		if err != nil || action == "Discard" {
+			return nil
+		}
+		if action == "Save Encrypted Backup" {
+			path := ""
+			survey.AskOne(&survey.Input{Message: "Backup file path:", Default: "yggdrasil-mined-key.json"}, &path)
+			if path == "" {
+				continue
+			}
+			if err := writeKeyBackup(priv, path); err != nil {
+				fmt.Println(red("Error: "), err)
+			}
+			continue
+		}
+		if !confirmKeyChange(priv) {
+			continue
+		}
+		if err := installPrivateKey(priv); err != nil {
+			return err
+		}
+		restartServicePrompt()
+		return nil
+	}
+}
+
+// mineKeyMenu asks for a target interactively.
+func mineKeyMenu() error {
+	ones, ok := askNumber("Minimum strength (leading ones, 0 = any):", 0, 0, 64)
+	if !ok {
+		return nil
+	}
+	prefix := ""
+	survey.AskOne(&survey.Input{
+		Message: "Address prefix (optional, e.g. 201:cafe):",
+		Help:    "Addresses start with 2 followed by the strength in hex, so 20a: means strength 10.",
+	}, &prefix)
+	t, err := parseMineTarget(ones, prefix)
+	if err != nil {
+		return err
+	}
+	priv := mineKey(t)
+	if priv == nil {
+		fmt.Println(yellow("Stopped without a match."))
+		return nil
+	}
+	return offerMinedKey(priv)
+}
+
+// mineCommand handles "ygglazy keys mine [--ones N] [--prefix P]".
+func mineCommand(args []string) error {
+	fs := flag.NewFlagSet("keys mine", flag.ContinueOnError)
+	ones := fs.Int("ones", 0, "minimum number of leading one bits")
+	prefix := fs.String("prefix", "", "address prefix, e.g. 201:cafe")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	t, err := parseMineTarget(*ones, *prefix)
+	if err != nil {
+		return err
+	}
+	priv := mineKey(t)
+	if priv == nil {
+		fmt.Println(yellow("Stopped without a match."))
+		return nil
+	}
+	return offerMinedKey(priv)
+}
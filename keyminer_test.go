@@ -0,0 +1,93 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestParseMineTarget(t *testing.T) {
+	tests := []struct {
+		ones    int
+		prefix  string
+		wantErr string
+	}{
+		{ones: 12},
+		{prefix: "2"},
+		{prefix: "20"},
+		{prefix: "20c"},
+		{prefix: "20C:"},
+		{prefix: "20c:cafe"},
+		{prefix: "20c:0:1"},
+		{ones: 10, prefix: " 20f:beef "},
+		{prefix: "20:abc", wantErr: "always has 3 digits, e.g. 20c:abc"},
+		{prefix: "2:", wantErr: "always has 3 digits"},
+		{prefix: "2:1", wantErr: "always has 3 digits"},
+		{prefix: "2000", wantErr: "at most 3 digits"},
+		{prefix: "300", wantErr: "200::/7"},
+		{prefix: "20c:xyz", wantErr: "200::/7"},
+		{prefix: "20c:0abc", wantErr: "no leading zeros"},
+		{prefix: "20c:12345", wantErr: "at most 4 digits"},
+		{ones: -1, wantErr: "between 0 and 64"},
+		{ones: 65, wantErr: "between 0 and 64"},
+		{wantErr: "set a minimum strength or an address prefix"},
+		{ones: 10, prefix: "205", wantErr: "contradicts strength 10"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.prefix, func(t *testing.T) {
+			target, err := parseMineTarget(tt.ones, tt.prefix)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("parseMineTarget(%d, %q) error = %v, want %q", tt.ones, tt.prefix, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseMineTarget(%d, %q) error = %v", tt.ones, tt.prefix, err)
+			}
+			if want := strings.ToLower(strings.TrimSpace(tt.prefix)); target.Prefix != want || target.MinOnes != tt.ones {
+				t.Errorf("parseMineTarget() = %+v", target)
+			}
+		})
+	}
+}
+
+func TestExpectedTries(t *testing.T) {
+	tests := []struct {
+		target MineTarget
+		want   float64
+	}{
+		{MineTarget{MinOnes: 10}, 1 << 10},
+		{MineTarget{Prefix: "2"}, 1},
+		{MineTarget{Prefix: "20c"}, 1 << 13},
+		{MineTarget{Prefix: "20c:"}, 1 << 13},
+		{MineTarget{Prefix: "20c:ab"}, 1 << 21},
+		{MineTarget{Prefix: "20c:ab:1"}, 1 << 25},
+		{MineTarget{MinOnes: 12, Prefix: "20c"}, 1 << 13},
+		{MineTarget{Prefix: "21"}, 1 << 16},
+		{MineTarget{MinOnes: 20, Prefix: "21"}, 1 << 20},
+		{MineTarget{MinOnes: 10, Prefix: "205"}, math.Inf(1)},
+	}
+	for _, tt := range tests {
+		if got := tt.target.ExpectedTries(); got != tt.want {
+			t.Errorf("%s: ExpectedTries() = %v, want %v", tt.target, got, tt.want)
+		}
+	}
+}
+
+func TestMineTargetMatch(t *testing.T) {
+	addr := []byte{0x02, 0x0c, 0xca, 0xfe}
+	for _, tt := range []struct {
+		target MineTarget
+		want   bool
+	}{
+		{MineTarget{MinOnes: 12}, true},
+		{MineTarget{MinOnes: 13}, false},
+		{MineTarget{Prefix: "20c:ca"}, true},
+		{MineTarget{Prefix: "20c:cb"}, false},
+	} {
+		if got := tt.target.Match(addr, "20c:cafe::1"); got != tt.want {
+			t.Errorf("%s: Match() = %v, want %v", tt.target, got, tt.want)
+		}
+	}
+}
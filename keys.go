@@ -0,0 +1,366 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/AlecAivazis/survey/v2"
+	"github.com/AlecAivazis/survey/v2/terminal"
+)
+
+// --- Node Identity ---
+
+const (
+	keyBackupFormat     = "ygglazy-key-backup"
+	keyBackupIterations = 600000
+)
+
+// KeyBackup is the on-disk format of an exported private key. The hex key is
+// sealed with AES-256-GCM under a key derived from the passphrase.
+type KeyBackup struct {
+	Format     string `json:"format"`
+	Version    int    `json:"version"`
+	PublicKey  string `json:"public_key"`
+	KDF        string `json:"kdf"`
+	Iterations int    `json:"iterations"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// addrForKey derives the node's 200::/7 address from its public key, the
+// same way Yggdrasil does: invert the key, count the leading one bits into
+// the second byte, and fill the rest with the bits after the first zero.
+func addrForKey(pub ed25519.PublicKey) net.IP {
+	var buf [ed25519.PublicKeySize]byte
+	copy(buf[:], pub)
+	for i := range buf {
+		buf[i] = ^buf[i]
+	}
+
+	addr := make(net.IP, net.IPv6len)
+	addr[0] = 0x02
+	var temp []byte
+	done := false
+	ones := byte(0)
+	bits := byte(0)
+	nBits := 0
+	for idx := 0; idx < 8*len(buf); idx++ {
+		bit := (buf[idx/8] & (0x80 >> byte(idx%8))) >> byte(7-(idx%8))
+		if !done && bit != 0 {
+			ones++
+			continue
+		}
+		if !done && bit == 0 {
+			done = true
+			continue
+		}
+		bits = (bits << 1) | bit
+		nBits++
+		if nBits == 8 {
+			nBits = 0
+			temp = append(temp, bits)
+		}
+	}
+	addr[1] = ones
+	copy(addr[2:], temp)
+	return addr
+}
+
+// subnetForKey returns the routed 300::/7 /64 prefix of the node.
+func subnetForKey(pub ed25519.PublicKey) *net.IPNet {
+	addr := addrForKey(pub)
+	subnet := make(net.IP, net.IPv6len)
+	copy(subnet, addr[:8])
+	subnet[0] |= 0x01
+	return &net.IPNet{IP: subnet, Mask: net.CIDRMask(64, 128)}
+}
+
+func parsePrivateKey(s string) (ed25519.PrivateKey, error) {
+	b, err := hex.DecodeString(s)
+	if err != nil || len(b) != ed25519.PrivateKeySize {
+		return nil, fmt.Errorf("PrivateKey must be %d hex characters", 2*ed25519.PrivateKeySize)
+	}
+	priv := ed25519.PrivateKey(b)
+	// The second half is the public key; it must match the seed
+	if !priv.Equal(ed25519.NewKeyFromSeed(priv.Seed())) {
+		return nil, fmt.Errorf("PrivateKey is corrupt: public half does not match the seed")
+	}
+	return priv, nil
+}
+
+func configPrivateKey(cfg *Config) (ed25519.PrivateKey, error) {
+	n := cfg.Get("PrivateKey")
+	if n == nil || n.Kind != NodeString {
+		return nil, fmt.Errorf("no PrivateKey in config (Yggdrasil 0.4 and older configs are not supported)")
+	}
+	return parsePrivateKey(n.Value)
+}
+
+func printIdentity(priv ed25519.PrivateKey) {
+	pub := priv.Public().(ed25519.PublicKey)
+	fmt.Printf("Public key: %s\n", hex.EncodeToString(pub))
+	fmt.Printf("Address:    %s\n", addrForKey(pub))
+	fmt.Printf("Subnet:     %s\n", subnetForKey(pub))
+	fmt.Printf("Strength:   %d leading ones\n", addrForKey(pub)[1])
+}
+
+// installPrivateKey replaces the node identity through the normal backup
+// and validation path.
+func installPrivateKey(priv ed25519.PrivateKey) error {
+	cfg, err := loadConfig(detectedConfigPath)
+	if err != nil {
+		return err
+	}
+	cfg.Set("PrivateKey", newStringNode(hex.EncodeToString(priv)))
+	if err := cfg.Save(); err != nil {
+		return err
+	}
+	fmt.Println(green("New private key installed. Previous config backed up to " + cfg.Backup))
+	return nil
+}
+
+func confirmKeyChange(priv ed25519.PrivateKey) bool {
+	fmt.Println(yellow("\nThe node's address and subnet will change to:"))
+	printIdentity(priv)
+	fmt.Println(yellow("Anything that reaches this node by its current address will stop working."))
+	confirm := false
+	survey.AskOne(&survey.Confirm{Message: "Replace the node's private key?"}, &confirm)
+	return confirm
+}
+
+func deriveBackupKey(passphrase string, salt []byte, iterations int) ([]byte, error) {
+	return pbkdf2.Key(sha256.New, passphrase, salt, iterations, 32)
+}
+
+func encryptPrivateKey(priv ed25519.PrivateKey, passphrase string) (*KeyBackup, error) {
+	b := &KeyBackup{
+		Format:     keyBackupFormat,
+		Version:    1,
+		PublicKey:  hex.EncodeToString(priv.Public().(ed25519.PublicKey)),
+		KDF:        "pbkdf2-sha256",
+		Iterations: keyBackupIterations,
+		Salt:       make([]byte, 16),
+	}
+	if _, err := rand.Read(b.Salt); err != nil {
+		return nil, err
+	}
+	key, err := deriveBackupKey(passphrase, b.Salt, b.Iterations)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	b.Nonce = make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(b.Nonce); err != nil {
+		return nil, err
+	}
+	b.Ciphertext = gcm.Seal(nil, b.Nonce, []byte(hex.EncodeToString(priv)), []byte(b.PublicKey))
+	return b, nil
+}
+
+func decryptPrivateKey(b *KeyBackup, passphrase string) (ed25519.PrivateKey, error) {
+	if b.Format != keyBackupFormat || b.Version != 1 || b.KDF != "pbkdf2-sha256" {
+		return nil, fmt.Errorf("not a supported key backup file")
+	}
+	key, err := deriveBackupKey(passphrase, b.Salt, b.Iterations)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(b.Nonce) != gcm.NonceSize() {
+		return nil, fmt.Errorf("key backup is corrupt")
+	}
+	plain, err := gcm.Open(nil, b.Nonce, b.Ciphertext, []byte(b.PublicKey))
+	if err != nil {
+		return nil, fmt.Errorf("wrong passphrase or corrupt backup")
+	}
+	return parsePrivateKey(string(plain))
+}
+
+func exportKey(path string) error {
+	cfg, err := loadConfig(detectedConfigPath)
+	if err != nil {
+		return err
+	}
+	priv, err := configPrivateKey(cfg)
+	if err != nil {
+		return err
+	}
+	return writeKeyBackup(priv, path)
+}
+
+// writeKeyBackup asks for a passphrase and writes priv encrypted to path.
+func writeKeyBackup(priv ed25519.PrivateKey, path string) error {
+	passphrase, confirm := "", ""
+	if err := survey.AskOne(&survey.Password{Message: "Passphrase for the backup:"}, &passphrase); err != nil {
+		return err
+	}
+	if len(passphrase) < 8 {
+		return fmt.Errorf("passphrase must be at least 8 characters")
+	}
+	if err := survey.AskOne(&survey.Password{Message: "Repeat passphrase:"}, &confirm); err != nil {
+		return err
+	}
+	if passphrase != confirm {
+		return fmt.Errorf("passphrases do not match")
+	}
+
+	backup, err := encryptPrivateKey(priv, passphrase)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(backup, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(path, append(data, '\n'), 0600); err != nil {
+		return err
+	}
+	fmt.Println(green("Encrypted key backup written to " + path))
+	return nil
+}
+
+func importKey(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var backup KeyBackup
+	if err := json.Unmarshal(data, &backup); err != nil {
+		return fmt.Errorf("not a key backup file: %v", err)
+	}
+	passphrase := ""
+	if err := survey.AskOne(&survey.Password{Message: "Backup passphrase:"}, &passphrase); err != nil {
+		return err
+	}
+	priv, err := decryptPrivateKey(&backup, passphrase)
+	if err != nil {
+		return err
+	}
+	if !confirmKeyChange(priv) {
+		return nil
+	}
+	if err := installPrivateKey(priv); err != nil {
+		return err
+	}
+	restartServicePrompt()
+	return nil
+}
+
+func rotateKey() error {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	fmt.Println(yellow("Tip: export the current key first if you may want it back."))
+	if !confirmKeyChange(priv) {
+		return nil
+	}
+	if err := installPrivateKey(priv); err != nil {
+		return err
+	}
+	restartServicePrompt()
+	return nil
+}
+
+func showIdentity() error {
+	cfg, err := loadConfig(detectedConfigPath)
+	if err != nil {
+		return err
+	}
+	priv, err := configPrivateKey(cfg)
+	if err != nil {
+		return err
+	}
+	printIdentity(priv)
+	return nil
+}
+
+func keysMenu() {
+	for {
+		clearScreen()
+		fmt.Println(cyan("=== Node Identity ===\n"))
+		if err := showIdentity(); err != nil {
+			fmt.Println(red("Error: "), err)
+		}
+		fmt.Println()
+
+		action := ""
+		err := survey.AskOne(&survey.Select{
+			Message: "Keys Menu (Esc to back):",
+			Options: []string{"Export Encrypted Backup", "Import From Backup", "Generate New Key", "Mine Vanity/Strong Key", "Back"},
+		}, &action)
+		if err == terminal.InterruptErr || action == "Back" || action == "" {
+			return
+		}
+
+		switch action {
+		case "Export Encrypted Backup", "Import From Backup":
+			path := ""
+			survey.AskOne(&survey.Input{Message: "Backup file path:", Default: "yggdrasil-key.json"}, &path)
+			if path == "" {
+				continue
+			}
+			if action == "Export Encrypted Backup" {
+				err = exportKey(path)
+			} else {
+				err = importKey(path)
+			}
+		case "Generate New Key":
+			err = rotateKey()
+		case "Mine Vanity/Strong Key":
+			err = mineKeyMenu()
+		}
+		if err != nil {
+			fmt.Println(red("Error: "), err)
+		}
+		waitEnter()
+	}
+}
+
+// keysCommand handles "ygglazy keys ...".
+func keysCommand(args []string) error {
+	if len(args) == 0 {
+		args = []string{"show"}
+	}
+	switch args[0] {
+	case "show":
+		return showIdentity()
+	case "rotate":
+		return rotateKey()
+	case "mine":
+		return mineCommand(args[1:])
+	case "export", "import":
+		if len(args) < 2 {
+			return fmt.Errorf("usage: ygglazy keys %s <file>", args[0])
+		}
+		if args[0] == "export" {
+			return exportKey(args[1])
+		}
+		return importKey(args[1])
+	}
+	return fmt.Errorf("unknown keys command: %s", args[0])
+}
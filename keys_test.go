@@ -0,0 +1,72 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestAddrForKey(t *testing.T) {
+	tests := []struct {
+		pub    string
+		addr   string
+		subnet string
+	}{
+		// The vector from yggdrasil-go's src/address/address_test.go
+		{
+			pub:    "bdbacfd82240de3dcd123924cbb55256fb8dab08aa98e305528ab84f419e6efb",
+			addr:   "200:848a:604f:bb7e:4384:65db:8db6:6895",
+			subnet: "300:848a:604f:bb7e::/64",
+		},
+		// 20 leading zero bits, checked against yggdrasil-go's AddrForKey
+		{
+			pub:    "00000f3d5c4a8b2e91f7c6d0a3b5e8f1c2d4a6b8e0f1a3c5d7e9f0b2c4d6e8fa",
+			addr:   "214:1854:76ae:9a2d:c107:25eb:8942:e1c7",
+			subnet: "314:1854:76ae:9a2d::/64",
+		},
+	}
+	for _, tt := range tests {
+		b, err := hex.DecodeString(tt.pub)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pub := ed25519.PublicKey(b)
+		if got := addrForKey(pub).String(); got != tt.addr {
+			t.Errorf("addrForKey(%s) = %s, want %s", tt.pub, got, tt.addr)
+		}
+		if got := subnetForKey(pub).String(); got != tt.subnet {
+			t.Errorf("subnetForKey(%s) = %s, want %s", tt.pub, got, tt.subnet)
+		}
+	}
+}
+
+func TestKeyBackupRoundTrip(t *testing.T) {
+	priv := ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+	b, err := encryptPrivateKey(priv, "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b.Ciphertext), hex.EncodeToString(priv)) {
+		t.Fatal("backup contains the plain key")
+	}
+	got, err := decryptPrivateKey(b, "correct horse")
+	if err != nil {
+		t.Fatalf("decryptPrivateKey() error = %v", err)
+	}
+	if !got.Equal(priv) {
+		t.Error("decrypted key differs from the original")
+	}
+
+	if _, err := decryptPrivateKey(b, "wrong horse"); err == nil || !strings.Contains(err.Error(), "wrong passphrase") {
+		t.Errorf("wrong passphrase: error = %v", err)
+	}
+	b.Ciphertext[0] ^= 1
+	if _, err := decryptPrivateKey(b, "correct horse"); err == nil {
+		t.Error("tampered backup was accepted")
+	}
+	b.Format = "other"
+	if _, err := decryptPrivateKey(b, "correct horse"); err == nil || !strings.Contains(err.Error(), "not a supported") {
+		t.Errorf("unknown format: error = %v", err)
+	}
+}
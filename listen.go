@@ -0,0 +1,367 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/AlecAivazis/survey/v2"
+	"github.com/AlecAivazis/survey/v2/terminal"
+)
+
+// --- Listen Addresses ---
+
+var listenSchemes = []string{"tcp", "tls", "quic", "ws"}
+
+// parseListenURI checks a Listen entry such as "tls://[::]:443".
+func parseListenURI(s string) (*PeerURI, error) {
+	p, err := parseURI(s, true)
+	if err != nil {
+		return nil, err
+	}
+	for _, scheme := range listenSchemes {
+		if p.Scheme == scheme {
+			return p, nil
+		}
+	}
+	return nil, fmt.Errorf("listeners must use one of %s, not %s", strings.Join(listenSchemes, ", "), p.Scheme)
+}
+
+// isWildcardListen reports whether a listener binds every address.
+func isWildcardListen(p *PeerURI) bool {
+	ip := net.ParseIP(p.Host)
+	return p.Host == "" || (ip != nil && ip.IsUnspecified())
+}
+
+// sameListener reports whether two Listen entries bind the same socket. An
+// empty host binds like [::], so "tcp://:1234" and "tcp://[::]:1234" match,
+// and addresses compare in their canonical form.
+func sameListener(a, b string) bool {
+	pa, err := parseListenURI(a)
+	if err != nil {
+		return a == b
+	}
+	pb, err := parseListenURI(b)
+	if err != nil {
+		return false
+	}
+	for _, p := range []*PeerURI{pa, pb} {
+		if p.Host == "" {
+			p.Host = "::"
+		}
+		if ip := net.ParseIP(p.Host); ip != nil {
+			p.Host = ip.String()
+		}
+	}
+	return pa.Endpoint() == pb.Endpoint()
+}
+
+// portFree reports whether this host can bind the port on the given network.
+func portFree(network, host string, port int) bool {
+	if ip := net.ParseIP(host); ip != nil && ip.IsUnspecified() {
+		host = "" // Bind every family, like Yggdrasil does for [::]
+	}
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+	if network == "udp" {
+		conn, err := net.ListenPacket("udp", addr)
+		if err != nil {
+			return false
+		}
+		conn.Close()
+		return true
+	}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return false
+	}
+	l.Close()
+	return true
+}
+
+// suggestFreePort picks a random high port that is free for the scheme.
+func suggestFreePort(scheme, host string) int {
+	network := "tcp"
+	if scheme == "quic" {
+		network = "udp"
+	}
+	for i := 0; i < 50; i++ {
+		port := 10000 + rand.Intn(50000)
+		if portFree(network, host, port) {
+			return port
+		}
+	}
+	return 0
+}
+
+// checkListenConflicts returns a warning for a new listener whose port is
+// already in use, either by another Listen entry or on this host.
+func checkListenConflicts(existing []string, p *PeerURI) string {
+	for _, e := range existing {
+		ep, err := parseListenURI(e)
+		if err != nil {
+			continue
+		}
+		if ep.Port == p.Port && ep.Network() == p.Network() {
+			return fmt.Sprintf("port %s/%s is already used by %s", p.Port, p.Network(), e)
+		}
+	}
+	port, _ := strconv.Atoi(p.Port)
+	if !portFree(p.Network(), p.Host, port) {
+		return fmt.Sprintf("port %s/%s is already in use on this host (fine if Yggdrasil itself holds it)", p.Port, p.Network())
+	}
+	return ""
+}
+
+// publicListenWarning warns when anyone could peer with a wildcard listener.
+func publicListenWarning(cfg *Config) string {
+	if len(cfg.StringList("AllowedPublicKeys")) > 0 {
+		return ""
+	}
+	for _, l := range cfg.StringList("Listen") {
+		if p, err := parseListenURI(l); err == nil && isWildcardListen(p) {
+			return "Listening on all addresses with an empty AllowedPublicKeys: anyone can peer with this node."
+		}
+	}
+	return ""
+}
+
+// addListenAddress adds a listener, reporting whether it was saved. A
+// listener that lets anyone peer is only saved once the user confirms.
+func addListenAddress(uri string) (bool, error) {
+	p, err := parseListenURI(uri)
+	if err != nil {
+		return false, err
+	}
+	cfg, err := loadConfig(detectedConfigPath)
+	if err != nil {
+		return false, err
+	}
+	existing := cfg.StringList("Listen")
+	for _, e := range existing {
+		if sameListener(e, uri) {
+			return false, fmt.Errorf("%s is already configured as %s", uri, e)
+		}
+	}
+	if warning := checkListenConflicts(existing, p); warning != "" {
+		fmt.Println(yellow("Warning: " + warning))
+	}
+	cfg.SetStringList("Listen", append(existing, uri))
+	if warning := publicListenWarning(cfg); warning != "" {
+		fmt.Println(yellow("Warning: " + warning))
+		confirm := false
+		survey.AskOne(&survey.Confirm{Message: "Add this listener anyway?"}, &confirm)
+		if !confirm {
+			return false, nil
+		}
+	}
+	if err := cfg.Save(); err != nil {
+		return false, err
+	}
+	fmt.Println(green("Listener added: " + uri))
+	return true, nil
+}
+
+// removeListenAddresses drops the entries that bind the same socket as one
+// of toRemove, however the address is spelled.
+func removeListenAddresses(toRemove []string) error {
+	cfg, err := loadConfig(detectedConfigPath)
+	if err != nil {
+		return err
+	}
+	var keep []string
+	for _, l := range cfg.StringList("Listen") {
+		shouldRemove := false
+		for _, rem := range toRemove {
+			if sameListener(l, rem) {
+				shouldRemove = true
+				break
+			}
+		}
+		if !shouldRemove {
+			keep = append(keep, l)
+		}
+	}
+	if len(keep) == len(cfg.StringList("Listen")) {
+		return fmt.Errorf("no matching listeners in config")
+	}
+	cfg.SetStringList("Listen", keep)
+	if err := cfg.Save(); err != nil {
+		return err
+	}
+	fmt.Println(green("Listeners removed."))
+	return nil
+}
+
+// askListenAddress walks the user through building a listener URI.
+func askListenAddress() (string, bool) {
+	scheme := ""
+	err := survey.AskOne(&survey.Select{Message: "Protocol:", Options: listenSchemes, Default: "tls"}, &scheme)
+	if err != nil {
+		return "", false
+	}
+
+	bind := ""
+	err = survey.AskOne(&survey.Select{
+		Message: "Bind address:",
+		Options: []string{"[::] (all IPv4 and IPv6)", "0.0.0.0 (all IPv4)", "Specific address"},
+	}, &bind)
+	if err != nil {
+		return "", false
+	}
+	host := "::"
+	switch {
+	case strings.HasPrefix(bind, "0.0.0.0"):
+		host = "0.0.0.0"
+	case bind == "Specific address":
+		err = survey.AskOne(&survey.Input{Message: "IP address to bind:"}, &host, survey.WithValidator(func(ans interface{}) error {
+			if net.ParseIP(strings.Trim(ans.(string), "[]")) == nil {
+				return fmt.Errorf("not an IP address")
+			}
+			return nil
+		}))
+		if err != nil {
+			return "", false
+		}
+		host = strings.Trim(host, "[]")
+	}
+
+	suggested := suggestFreePort(scheme, host)
+	portStr := ""
+	portPrompt := &survey.Input{Message: "Port:"}
+	if suggested != 0 {
+		portPrompt.Default = strconv.Itoa(suggested)
+		portPrompt.Help = "The suggested port is free on this host right now."
+	}
+	err = survey.AskOne(portPrompt, &portStr, survey.WithValidator(func(ans interface{}) error {
+		n, err := strconv.Atoi(ans.(string))
+		if err != nil || n < 1 || n > 65535 {
+			return fmt.Errorf("port must be 1-65535")
+		}
+		return nil
+	}))
+	if err != nil {
+		return "", false
+	}
+	return fmt.Sprintf("%s://%s", scheme, net.JoinHostPort(host, portStr)), true
+}
+
+func listenMenu() {
+	for {
+		clearScreen()
+		fmt.Println(cyan("=== Listen Addresses ==="))
+		cfg, err := loadConfig(detectedConfigPath)
+		if err != nil {
+			fmt.Println(red("Error: "), err)
+			waitEnter()
+			return
+		}
+		listen := cfg.StringList("Listen")
+		if len(listen) == 0 {
+			fmt.Println(yellow("No listeners configured. Other nodes can't peer with this one."))
+		}
+		for i, l := range listen {
+			fmt.Printf("%d. %s\n", i+1, l)
+		}
+		if warning := publicListenWarning(cfg); warning != "" {
+			fmt.Println(yellow("\nWarning: " + warning))
+		}
+		fmt.Println()
+
+		action := ""
+		err = survey.AskOne(&survey.Select{
+			Message: "Listen Menu (Esc to back):",
+			Options: []string{"Add Listener", "Remove Listeners", "Back"},
+		}, &action)
+		if err == terminal.InterruptErr || action == "Back" || action == "" {
+			return
+		}
+
+		switch action {
+		case "Add Listener":
+			uri, ok := askListenAddress()
+			if !ok {
+				continue
+			}
+			added, err := addListenAddress(uri)
+			if err != nil {
+				fmt.Println(red("Failed to update config: "), err)
+				waitEnter()
+				continue
+			}
+			if added {
+				restartServicePrompt()
+			}
+		case "Remove Listeners":
+			if len(listen) == 0 {
+				continue
+			}
+			toRemove := []string{}
+			err := survey.AskOne(&survey.MultiSelect{Message: "Select to Remove:", Options: listen}, &toRemove)
+			if err != nil || len(toRemove) == 0 {
+				continue
+			}
+			if err := removeListenAddresses(toRemove); err != nil {
+				fmt.Println(red("Failed to update config: "), err)
+				waitEnter()
+				continue
+			}
+			restartServicePrompt()
+		}
+	}
+}
+
+// listenCommand handles "ygglazy listen ...".
+func listenCommand(args []string) error {
+	if len(args) == 0 {
+		args = []string{"list"}
+	}
+	switch args[0] {
+	case "list":
+		cfg, err := loadConfig(detectedConfigPath)
+		if err != nil {
+			return err
+		}
+		for _, l := range cfg.StringList("Listen") {
+			fmt.Println(l)
+		}
+		if warning := publicListenWarning(cfg); warning != "" {
+			fmt.Println(yellow("Warning: " + warning))
+		}
+		return nil
+	case "add":
+		if len(args) < 2 {
+			return fmt.Errorf("usage: ygglazy listen add <scheme://host:port>")
+		}
+		added, err := addListenAddress(args[1])
+		if err != nil {
+			return err
+		}
+		if added {
+			restartServicePrompt()
+		}
+		return nil
+	case "remove":
+		if len(args) < 2 {
+			return fmt.Errorf("usage: ygglazy listen remove <scheme://host:port>")
+		}
+		if err := removeListenAddresses(args[1:]); err != nil {
+			return err
+		}
+		restartServicePrompt()
+		return nil
+	case "suggest-port":
+		scheme := "tls"
+		if len(args) > 1 {
+			scheme = args[1]
+		}
+		port := suggestFreePort(scheme, "::")
+		if port == 0 {
+			return fmt.Errorf("no free port found")
+		}
+		fmt.Println(port)
+		return nil
+	}
+	return fmt.Errorf("unknown listen command: %s", args[0])
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseListenURI(t *testing.T) {
+	tests := []struct {
+		uri      string
+		wantErr  bool
+		wildcard bool
+	}{
+		{uri: "tls://[::]:443", wildcard: true},
+		{uri: "tcp://0.0.0.0:1234", wildcard: true},
+		{uri: "tcp://:1234", wildcard: true},
+		{uri: "quic://192.0.2.1:443"},
+		{uri: "ws://[2001:db8::1]:80"},
+		{uri: "tcp://:0", wantErr: true},
+		{uri: "socks://:1080/peer.example:1", wantErr: true},
+		{uri: "unix:///run/ygg.sock", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.uri, func(t *testing.T) {
+			p, err := parseListenURI(tt.uri)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseListenURI() error = %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil && isWildcardListen(p) != tt.wildcard {
+				t.Errorf("isWildcardListen() = %v, want %v", !tt.wildcard, tt.wildcard)
+			}
+		})
+	}
+	if _, err := parsePeerURI("tcp://:1234"); err == nil {
+		t.Error("parsePeerURI() took a peer without a host")
+	}
+	if p, _ := parseListenURI("tcp://:1234"); p.String() != "tcp://:1234" {
+		t.Errorf("String() = %s", p)
+	}
+}
+
+func TestSameListener(t *testing.T) {
+	for _, tt := range []struct {
+		a, b string
+		want bool
+	}{
+		{"tcp://:1234", "tcp://:1234", true},
+		{"tcp://:1234", "tcp://[::]:1234", true},
+		{"tcp://[0:0::0]:1234", "tcp://:1234", true},
+		{"TLS://[::]:443", "tls://[::]:443?key=", true},
+		{"tcp://:1234", "tls://:1234", false},
+		{"tcp://:1234", "tcp://:1235", false},
+		{"tcp://0.0.0.0:1234", "tcp://:1234", false},
+	} {
+		if got := sameListener(tt.a, tt.b); got != tt.want {
+			t.Errorf("sameListener(%s, %s) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestRemoveListenAddresses(t *testing.T) {
+	t.Setenv("PATH", "")
+	saved := detectedConfigPath
+	defer func() { detectedConfigPath = saved }()
+	detectedConfigPath = filepath.Join(t.TempDir(), "yggdrasil.conf")
+	os.WriteFile(detectedConfigPath, []byte(`{
+  Listen: [
+    tcp://[::]:1234
+    tls://0.0.0.0:443
+    quic://[::]:443
+  ]
+}
+`), 0600)
+
+	// The argument is spelled differently from the config entry
+	if err := removeListenAddresses([]string{"tcp://:1234"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := removeListenAddresses([]string{"tcp://:1234"}); err == nil {
+		t.Error("removing a listener twice succeeded")
+	}
+	if err := removeListenAddresses([]string{"tls://[::]:443"}); err == nil {
+		t.Error("tls://[::]:443 removed tls://0.0.0.0:443")
+	}
+	cfg, err := loadConfig(detectedConfigPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"tls://0.0.0.0:443", "quic://[::]:443"}
+	if got := cfg.StringList("Listen"); !reflect.DeepEqual(got, want) {
+		t.Errorf("Listen = %v, want %v", got, want)
+	}
+}
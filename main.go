@@ -2,19 +2,18 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"math"
-	"net"
-	"net/http"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
-	"regexp"
 	"runtime"
-	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -47,7 +46,17 @@ var (
 // --- Structures ---
 
 type GitTreeResponse struct {
-	Tree []GitNode `json:"tree"`
+	Tree      []GitNode `json:"tree"`
+	Truncated bool      `json:"truncated"` // The tree had more entries than the API returns
+}
+
+type GitRelease struct {
+	Assets []GitAsset `json:"assets"`
+}
+
+type GitAsset struct {
+	Name string `json:"name"`
+	URL  string `json:"browser_download_url"`
 }
 
 type GitNode struct {
@@ -58,12 +67,31 @@ type GitNode struct {
 
 type Peer struct {
 	URI             string
-	Latency         time.Duration
+	Latency         time.Duration // Median (p50) of the probes kept
 	MinLatency      time.Duration
 	MaxLatency      time.Duration
-	Jitter          time.Duration // Standard deviation of latency
-	Stability       float64       // Lower is better (0-1 scale)
-	YggdrasilStatus bool          // true if confirmed to be a Yggdrasil node
+	P90             time.Duration
+	P99             time.Duration
+	Loss            float64        // Share of failed probes (0-1)
+	Samples         int            // Probes kept for the statistics
+	Outliers        int            // Slow probes left out as outliers
+	Jitter          time.Duration  // Standard deviation of latency
+	Stability       float64        // Lower is better (0-1 scale)
+	Connect         time.Duration  // Average connect time
+	Handshake       time.Duration  // Average TLS/WebSocket/QUIC handshake time
+	LastError       string         // Why the last failed attempt failed
+	YggdrasilStatus bool           // true if confirmed to be a Yggdrasil node
+	PublicKey       string         // Key announced in the handshake, hex
+	Protocol        string         // Protocol version announced in the handshake
+	Rejected        string         // Why an open port isn't a usable Yggdrasil node
+	VerifyError     string         // Why the handshake couldn't be checked
+	Unverifiable    bool           // The link type can't be handshake-checked (socks); ranked below every verified peer
+	Families        []FamilyResult // Per address family results, nil if not dialled by address
+	Feed            *FeedStatus    // Status feed data, nil if no feed lists the peer
+	Region          string         // From the peer list, for diversity scoring
+	Country         string
+	Operator        string
+	Score           PeerScore // Set by rankPeers
 }
 
 // --- Main ---
@@ -76,19 +104,92 @@ func main() {
 	versionFlagShort := flag.Bool("v", false, "Show version information (shorthand)")
 	helpFlag := flag.Bool("help", false, "Show help information")
 	helpFlagShort := flag.Bool("h", false, "Show help information (shorthand)")
+	flag.BoolVar(&offlineMode, "offline", false, "Use cached peer lists only")
+	flag.StringVar(&peerRepoFlags.Repo, "peers-repo", "", "Public peers repository (owner/name)")
+	flag.StringVar(&peerRepoFlags.Branch, "peers-branch", "", "Branch of the public peers repository")
+	flag.StringVar(&peerRepoFlags.API, "github-api", "", "GitHub-compatible API base URL")
+	flag.StringVar(&probeFlags.Preset, "preset", "", "Scan preset")
+	flag.IntVar(&probeFlags.Attempts, "attempts", 0, "Minimum probes per peer")
+	flag.IntVar(&probeFlags.MaxAttempts, "max-attempts", 0, "Maximum probes per peer")
+	flag.DurationVar(&probeFlags.Gap, "probe-gap", 0, "Pause between a peer's probes")
+	flag.DurationVar(&probeFlags.Timeout, "probe-timeout", 0, "Timeout of one probe")
+	flag.IntVar(&probeFlags.Workers, "workers", 0, "Peers probed at once")
+	flag.DurationVar(&probeFlags.MaxLatency, "max-latency", 0, "Don't rank slower peers")
+	flag.DurationVar(&probeFlags.ScanDeadline, "scan-deadline", 0, "Stop the scan after this long")
+	flag.IntVar(&probeFlags.Show, "show", 0, "Peers listed in the ranking")
+	flag.StringVar(&probeFlags.Strategy, "strategy", "", "Peer ranking strategy")
+	flag.Func("source", "Peer source (repeatable)", func(s string) error {
+		if _, err := parsePeerSource(s); err != nil {
+			return err
+		}
+		sourceFlags = append(sourceFlags, s)
+		return nil
+	})
 
 	// Custom usage function
 	flag.Usage = func() {
 		fmt.Printf("YggLazy-cli version %s - Lazy way to configure Yggdrasil Network!\n\n", version)
 		fmt.Println("USAGE:")
-		fmt.Printf("  %s [OPTIONS]\n\n", "ygglazy")
+		fmt.Printf("  %s [OPTIONS] [COMMAND]\n\n", "ygglazy")
 		fmt.Println("OPTIONS:")
 		fmt.Println("  -h, --help         Show this help message")
 		fmt.Println("  -v, --version      Show version information")
 		fmt.Println("  -i, --ygginstall   Install Yggdrasil automatically")
+		fmt.Println("  --offline          Rank and add peers from the cached peer lists only")
+		fmt.Println("  --source SPEC      Take public peers from SPEC instead of the saved sources;")
+		fmt.Println("                     repeat for several. SPEC is github:owner/repo[@branch],")
+		fmt.Println("                     dir:PATH, list:URL (text or JSON), git:URL[@branch]")
+		fmt.Println("                     or status:URL (status feed JSON with uptime data)")
+		fmt.Println("  --peers-repo O/N   Public peers repository (default: yggdrasil-network/public-peers)")
+		fmt.Println("  --peers-branch B   Branch of the peers repository (default: master)")
+		fmt.Println("  --github-api URL   API base for GitHub Enterprise or Gitea-compatible hosts")
+		fmt.Println("                     (default: https://api.github.com)")
+		fmt.Println("\nSCAN OPTIONS (override the Advanced menu settings):")
+		fmt.Println("  --preset NAME      quick, thorough, low-bandwidth or default")
+		fmt.Println("  --attempts N       Minimum probes per peer (default: 5)")
+		fmt.Println("  --max-attempts N   Probe up to N times while the latency is uncertain")
+		fmt.Println("                     (default: 15)")
+		fmt.Println("  --probe-gap D      Pause between a peer's probes (default: 150ms)")
+		fmt.Println("  --probe-timeout D  Timeout of one probe or handshake (default: 3s)")
+		fmt.Println("  --workers N        Peers probed at once (default: 20)")
+		fmt.Println("  --max-latency D    Don't rank peers slower than D (default: 5s)")
+		fmt.Println("  --scan-deadline D  Stop the whole scan after D (default: 15m)")
+		fmt.Println("  --show N           Peers listed in the ranking (default: 10)")
+		fmt.Println("  --strategy S       How peers are ranked (default: balanced). S is balanced,")
+		fmt.Println("                     diverse, or scorers with optional weights such as")
+		fmt.Println("                     latency=3,diversity,protocol:tls/quic. Scorers: latency,")
+		fmt.Println("                     stability, uptime, diversity (operator, country, region)")
+		fmt.Println("                     and protocol (default order tls/quic/wss/tcp/ws)")
+		fmt.Println("\nCOMMANDS:")
+		fmt.Println("  config backups          List config backups (newest first)")
+		fmt.Println("  config diff [N]         Show changes between the config and backup N")
+		fmt.Println("  config rollback [N]     Restore backup N (default: the latest)")
+		fmt.Println("  listen [list]           Show Listen addresses")
+		fmt.Println("  listen add URI          Add a listener, e.g. tls://[::]:443")
+		fmt.Println("  listen remove URI       Remove a listener")
+		fmt.Println("  listen suggest-port [S] Print a free port for scheme S (default: tls)")
+		fmt.Println("  keys [show]             Show public key, address and subnet")
+		fmt.Println("  keys rotate             Generate a new private key (address changes)")
+		fmt.Println("  keys mine [--ones N] [--prefix P]")
+		fmt.Println("                          Search for a key with strength >= N or address prefix P")
+		fmt.Println("  keys export FILE        Write a passphrase-encrypted key backup")
+		fmt.Println("  keys import FILE        Restore the private key from a backup")
+		fmt.Println("  sources [list]          Show the saved peer sources")
+		fmt.Println("  sources add SPEC        Save a peer source")
+		fmt.Println("  sources remove SPEC     Remove a saved peer source")
+		fmt.Println("\nENVIRONMENT:")
+		fmt.Println("  GITHUB_TOKEN       Token for github.com API requests (raises the 60/hour rate limit)")
+		fmt.Println("  YGGLAZY_GITHUB_API_TOKEN")
+		fmt.Println("                     Token for a custom --github-api host; GITHUB_TOKEN is never")
+		fmt.Println("                     sent there")
+		fmt.Println("  YGGLAZY_PEERS_REPO, YGGLAZY_PEERS_BRANCH, YGGLAZY_GITHUB_API")
+		fmt.Println("                     Same as the flags above; flags take precedence, and both")
+		fmt.Println("                     override peers_repo, peers_branch and github_api in the")
+		fmt.Println("                     settings file")
 		fmt.Println("\nEXAMPLES:")
 		fmt.Println("  sudo ygglazy                 # Start interactive configurator")
 		fmt.Println("  sudo ygglazy --ygginstall    # Auto-install Yggdrasil")
+		fmt.Println("  sudo ygglazy config rollback # Undo the last config change")
 		fmt.Println("  ygglazy --version            # Show version (no sudo needed)")
 		fmt.Println("\nFor more information, visit:")
 		fmt.Println("  https://github.com/Y-Akamirsky/ygg-lazy-cli")
@@ -110,6 +211,15 @@ func main() {
 		return
 	}
 
+	if err := resolvePeerRepo(); err != nil {
+		fmt.Println(red("Error: "), err)
+		os.Exit(1)
+	}
+	if err := resolveProbeConfig(); err != nil {
+		fmt.Println(red("Error: "), err)
+		os.Exit(1)
+	}
+
 	// Check/Request Admin Privileges for other operations
 	currentPlatform.EnsureAdmin()
 
@@ -126,6 +236,15 @@ func main() {
 		return
 	}
 
+	// Handle commands
+	if flag.NArg() > 0 {
+		if err := runCommand(flag.Args()); err != nil {
+			fmt.Println(red("Error: "), err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	// Check if config actually exists on disk
 	if !fileExists(detectedConfigPath) {
 		color.Yellow("Config file not found (%s).", detectedConfigPath)
@@ -143,7 +262,22 @@ func main() {
 	mainMenu()
 }
 
-// --- Path & Menu Helpers ---
+// --- Commands ---
+
+// runCommand dispatches non-interactive commands given after the flags.
+func runCommand(args []string) error {
+	switch args[0] {
+	case "config":
+		return configCommand(args[1:])
+	case "listen":
+		return listenCommand(args[1:])
+	case "keys":
+		return keysCommand(args[1:])
+	case "sources":
+		return sourcesCommand(args[1:])
+	}
+	return fmt.Errorf("unknown command: %s (see --help)", args[0])
+}
 
 // --- Menus ---
 
@@ -152,8 +286,19 @@ func mainMenu() {
 		clearScreen()
 		printBanner()
 		fmt.Printf("Config loaded: %s\n", detectedConfigPath)
+		if _, err := loadConfig(detectedConfigPath); err != nil {
+			fmt.Println(red("Config error: "), err)
+		}
+
+		if offlineMode {
+			msg := "Offline mode: no cached peer lists yet"
+			if updated := peerCacheUpdated(); !updated.IsZero() {
+				msg = "Offline mode: peer lists from cache, updated " + formatAge(updated)
+			}
+			fmt.Println(yellow(msg))
+		}
 
-		peers := getConfigPeers()
+		peers := getAllConfigPeers()
 		fmt.Printf("Active peers in config: %d\n\n", len(peers))
 
 		mode := ""
@@ -164,14 +309,23 @@ func mainMenu() {
 				"Manual Peer Selection",
 				"View Configured Peers",
 				"Check Active Peers Status",
+				"Pin Peer Keys",
 				"Remove Dead Peers",
 				"Remove Peers",
 				"Add Custom Peer",
+				"Move Peers (Global/Interface)",
+				"Listen Addresses",
+				"Multicast Discovery",
+				"Allowed Public Keys",
+				"Node Identity (Keys)",
+				"Peer Sources",
+				"Advanced Scan Settings",
 				"Node Status",
 				"Service Control",
+				"Restore Previous Config",
 				"Exit",
 			},
-			PageSize: 12,
+			PageSize: 19,
 		}
 
 		err := survey.AskOne(prompt, &mode)
@@ -189,16 +343,34 @@ func mainMenu() {
 			viewCurrentPeers()
 		case "Check Active Peers Status":
 			checkActivePeersStatus()
+		case "Pin Peer Keys":
+			pinPeerKeysMenu()
 		case "Remove Dead Peers":
 			removeDeadPeers()
 		case "Remove Peers":
 			removePeersMenu()
 		case "Add Custom Peer":
 			addCustomPeer()
+		case "Move Peers (Global/Interface)":
+			movePeerMenu()
+		case "Listen Addresses":
+			listenMenu()
+		case "Multicast Discovery":
+			multicastMenu()
+		case "Allowed Public Keys":
+			allowedKeysMenu()
+		case "Node Identity (Keys)":
+			keysMenu()
+		case "Peer Sources":
+			peerSourcesMenu()
+		case "Advanced Scan Settings":
+			advancedMenu()
 		case "Node Status":
 			showStatus()
 		case "Service Control":
 			serviceMenu()
+		case "Restore Previous Config":
+			restoreConfigMenu()
 		case "Exit":
 			fmt.Println("Bye!")
 			os.Exit(0)
@@ -231,14 +403,26 @@ func serviceMenu() {
 func viewCurrentPeers() {
 	clearScreen()
 	fmt.Println(cyan("=== Currently Configured Peers ==="))
-	peers := getConfigPeers()
+	cfg, err := loadConfig(detectedConfigPath)
+	if err != nil {
+		fmt.Println(red("Error: "), err)
+		waitEnter()
+		return
+	}
 
-	if len(peers) == 0 {
+	peers := cfg.PeerList("")
+	if len(peers) == 0 && len(cfg.PeerInterfaces()) == 0 {
 		fmt.Println(yellow("No peers found in config."))
 	} else {
 		for i, p := range peers {
 			fmt.Printf("%d. %s\n", i+1, p)
 		}
+		for _, iface := range cfg.PeerInterfaces() {
+			fmt.Printf("\n%s\n", cyan("Interface "+iface+":"))
+			for i, p := range cfg.PeerList(iface) {
+				fmt.Printf("%d. %s\n", i+1, p)
+			}
+		}
 	}
 	waitEnter()
 }
@@ -267,8 +451,11 @@ func installYggdrasil() {
 		if err == nil && len(out) > 0 {
 			dir := filepath.Dir(detectedConfigPath)
 			os.MkdirAll(dir, 0755)
-			os.WriteFile(detectedConfigPath, out, 0644)
-			fmt.Println(green("Config generated at " + detectedConfigPath))
+			if err := writeFileAtomic(detectedConfigPath, out, 0644); err != nil {
+				fmt.Println(red("Failed to write config: "), err)
+			} else {
+				fmt.Println(green("Config generated at " + detectedConfigPath))
+			}
 		} else {
 			fmt.Println(red("Failed to generate config automatically. Check if Yggdrasil is in PATH."))
 		}
@@ -293,77 +480,25 @@ func runCommands(cmds [][]string) error {
 
 // --- Logic: GitHub & Peers ---
 
-func fetchPeersStructure() (map[string][]string, error) {
-	fmt.Println("Scanning repository...")
-	resp, err := http.Get(fmt.Sprintf("https://api.github.com/repos/%s/%s/git/trees/master?recursive=1", repoOwner, repoPeers))
+// loadCandidates loads and merges the peers of every configured source.
+func loadCandidates() ([]PeerCandidate, error) {
+	sources, err := configuredPeerSources()
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
-
-	var treeResp GitTreeResponse
-	if err := json.NewDecoder(resp.Body).Decode(&treeResp); err != nil {
-		return nil, err
-	}
-
-	regionMap := make(map[string][]string)
-	for _, node := range treeResp.Tree {
-		if node.Type != "blob" || !strings.HasSuffix(node.Path, ".md") || strings.HasSuffix(node.Path, "README.md") {
-			continue
-		}
-		parts := strings.Split(node.Path, "/")
-		if len(parts) < 2 {
-			continue
-		}
-		region := parts[0]
-		rawUrl := fmt.Sprintf("https://raw.githubusercontent.com/%s/%s/master/%s", repoOwner, repoPeers, node.Path)
-		regionMap[region] = append(regionMap[region], rawUrl)
-	}
-	return regionMap, nil
-}
-
-func fetchPeersFromURLs(urls []string) []string {
-	var allPeers []string
-	var mu sync.Mutex
-	var wg sync.WaitGroup
-	sem := make(chan struct{}, 10)
-
-	for _, u := range urls {
-		wg.Add(1)
-		go func(url string) {
-			defer wg.Done()
-			sem <- struct{}{}
-			defer func() { <-sem }()
-
-			resp, err := http.Get(url)
-			if err == nil {
-				defer resp.Body.Close()
-				body, _ := io.ReadAll(resp.Body)
-				re := regexp.MustCompile(`(tcp|tls|quic|ws|wss)://[a-zA-Z0-9\.\-\:\[\]]+`)
-				matches := re.FindAllString(string(body), -1)
-				mu.Lock()
-				allPeers = append(allPeers, matches...)
-				mu.Unlock()
-			}
-		}(u)
-	}
-	wg.Wait()
-	return allPeers
+	ctx, cancel := interruptible(fetchTimeout)
+	defer cancel()
+	return loadPeerCandidates(ctx, sources)
 }
 
 func autoAddPeers() {
-	regionMap, err := fetchPeersStructure()
+	candidates, err := loadCandidates()
 	if err != nil {
 		fmt.Println(red("Error: "), err)
+		waitEnter()
 		return
 	}
-
-	// Build region list for selection
-	var regions []string
-	for region := range regionMap {
-		regions = append(regions, region)
-	}
-	sort.Strings(regions)
+	regions, regionMap := groupByRegion(candidates)
 
 	// Build region options
 	regionOptions := []string{"All regions"}
@@ -383,19 +518,35 @@ func autoAddPeers() {
 		return
 	}
 
-	// Collect URLs based on selection
-	var allUrls []string
+	// Collect peers based on selection
+	selected := candidates
 	if selectedRegion == "All regions" {
-		for _, u := range regionMap {
-			allUrls = append(allUrls, u...)
-		}
-		fmt.Printf("Fetching from %d regions...\n", len(regionMap))
+		fmt.Printf("Using peers from %d regions...\n", len(regionMap))
 	} else {
-		allUrls = regionMap[selectedRegion]
-		fmt.Printf("Fetching peers from %s region...\n", cyan(selectedRegion))
+		selected = regionMap[selectedRegion]
+		fmt.Printf("Using peers from %s region...\n", cyan(selectedRegion))
 	}
 
-	allPeers := fetchPeersFromURLs(allUrls)
+	// Skip peers the status feed already knows are dead
+	var allPeers []string
+	byURI := map[string]PeerCandidate{}
+	skipped := 0
+	for _, c := range selected {
+		if feedSkipReason(c.Feed) != "" {
+			skipped++
+			continue
+		}
+		allPeers = append(allPeers, c.URI)
+		byURI[c.URI] = c
+	}
+	if skipped > 0 {
+		fmt.Printf("Skipping %d peers the status feed reports as down or long unseen.\n", skipped)
+	}
+	if len(allPeers) == 0 {
+		fmt.Println(yellow("No peers found."))
+		waitEnter()
+		return
+	}
 	fmt.Printf("Total peers found: %d. Testing all...\n", len(allPeers))
 
 	// Shuffle
@@ -406,38 +557,60 @@ func autoAddPeers() {
 
 	limit := len(allPeers)
 
-	var ranked []Peer
+	var ranked, rejected, unverified []Peer
 	var mu sync.Mutex
 	var wg sync.WaitGroup
 	tested := 0
 
-	// Use 20 concurrent workers for pinging
-	workers := 20
+	workers := probeConfig.Workers
 	peerChan := make(chan string, limit)
 
-	fmt.Printf("Testing %d peers with 5 attempts each...\n", limit)
+	fmt.Printf("Testing %d peers with %d-%d attempts each and a Yggdrasil handshake...\n",
+		limit, probeConfig.Attempts, max(probeConfig.Attempts, probeConfig.MaxAttempts))
+	fmt.Println(yellow("Press Ctrl-C to stop early and choose from the peers tested so far."))
+	fmt.Printf("This host: %s\n", detectHostFamilies())
 	fmt.Println(yellow("Note: Final peer verification happens after adding them to config."))
 	fmt.Println(yellow("Use 'Check Active Peers Status' to verify and 'Remove Dead Peers' to clean up."))
 	fmt.Println()
 
+	ctx, cancel := interruptible(probeConfig.ScanDeadline)
+	defer cancel()
+
 	// Start workers
 	for i := 0; i < workers; i++ {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
 			for uri := range peerChan {
-				peer := pingPeerDetailed(uri)
+				if ctx.Err() != nil {
+					continue // Drain the queue
+				}
+				peer := pingPeerDetailed(ctx, uri)
+				if ctx.Err() != nil {
+					continue // Cut short, the numbers are incomplete
+				}
+				c := byURI[uri]
+				peer.Feed, peer.Region, peer.Country, peer.Operator = c.Feed, c.Region, c.Country, c.Operator
 
 				mu.Lock()
 				tested++
 
-				// Accept peers with reasonable latency
-				if peer.Latency < 5*time.Second {
-					ranked = append(ranked, peer)
-					fmt.Printf("\r[%d/%d] ✓ Found %d peers (last: %s, jitter: %s)",
-						tested, limit, len(ranked), peer.Latency, peer.Jitter)
-				} else {
+				// Accept verified Yggdrasil nodes with reasonable latency, and
+				// reachable peers whose link type can't be verified, to be
+				// ranked after them
+				switch {
+				case peer.Latency >= probeConfig.MaxLatency:
 					fmt.Printf("\r[%d/%d] ✗ Testing... (%d peers found)", tested, limit, len(ranked))
+				case peer.YggdrasilStatus || peer.Unverifiable:
+					ranked = append(ranked, peer)
+					fmt.Printf("\r[%d/%d] ✓ Found %d peers (last: p50 %s, loss %.0f%%)",
+						tested, limit, len(ranked), roundLatency(peer.Latency), peer.Loss*100)
+				case peer.Rejected != "":
+					rejected = append(rejected, peer)
+					fmt.Printf("\r[%d/%d] ✗ Rejected %d open ports that aren't Yggdrasil", tested, limit, len(rejected))
+				default:
+					unverified = append(unverified, peer)
+					fmt.Printf("\r[%d/%d] ? Reachable but unverified: %d", tested, limit, len(unverified))
 				}
 				mu.Unlock()
 			}
@@ -452,29 +625,85 @@ func autoAddPeers() {
 
 	// Wait for all workers to finish
 	wg.Wait()
+	scanErr := ctx.Err()
+	cancel()
 	fmt.Println()
 
-	// Sort by a combined score of latency and stability
-	sort.Slice(ranked, func(i, j int) bool {
-		// Calculate score: latency + (latency * stability)
-		scoreI := float64(ranked[i].Latency) * (1.0 + ranked[i].Stability)
-		scoreJ := float64(ranked[j].Latency) * (1.0 + ranked[j].Stability)
-		return scoreI < scoreJ
-	})
+	if scanErr != nil {
+		if errors.Is(scanErr, context.DeadlineExceeded) {
+			fmt.Println(yellow(fmt.Sprintf("\nScan deadline of %s reached.", probeConfig.ScanDeadline)))
+		} else {
+			fmt.Println(yellow("\nScan interrupted."))
+		}
+		fmt.Printf("Tested %d of %d peers.\n", tested, limit)
+		if len(ranked) > 0 {
+			keep := true
+			survey.AskOne(&survey.Confirm{
+				Message: fmt.Sprintf("Rank and choose from the %d peers found so far?", len(ranked)),
+				Default: true,
+			}, &keep)
+			if !keep {
+				return
+			}
+		}
+	}
+
+	ranked = rankPeers(ranked, rankStrategy)
 
 	// Print summary statistics
 	fmt.Printf("\n%s\n", cyan("=== Testing Summary ==="))
-	fmt.Printf("Total peers tested: %d\n", limit)
-	fmt.Printf("Peers found: %s\n", green(fmt.Sprintf("%d", len(ranked))))
+	fmt.Printf("Total peers tested: %d\n", tested)
+	unverifiable := 0
+	for _, p := range ranked {
+		if p.Unverifiable {
+			unverifiable++
+		}
+	}
+	fmt.Printf("Verified Yggdrasil peers: %s\n", green(fmt.Sprintf("%d", len(ranked)-unverifiable)))
+	if unverifiable > 0 {
+		fmt.Printf("Ranked last, without a handshake check (socks): %s\n", yellow(fmt.Sprintf("%d", unverifiable)))
+	}
+	if len(rejected) > 0 {
+		fmt.Printf("Rejected (open, not Yggdrasil): %s\n", red(fmt.Sprintf("%d", len(rejected))))
+	}
+	if len(unverified) > 0 {
+		fmt.Printf("Reachable but unverified: %s\n", yellow(fmt.Sprintf("%d", len(unverified))))
+	}
 
 	if len(ranked) > 0 {
-		fmt.Printf("Best latency: %s\n", green(ranked[0].Latency.String()))
-		fmt.Printf("Best stability: %.2f%%\n", (1.0-ranked[0].Stability)*100)
+		best, steadiest := ranked[0], ranked[0]
+		for _, p := range ranked {
+			if p.Latency < best.Latency {
+				best = p
+			}
+			if p.Stability < steadiest.Stability {
+				steadiest = p
+			}
+		}
+		fmt.Printf("Best latency: %s\n", green(roundLatency(best.Latency).String()))
+		fmt.Printf("Best stability: %.2f%%\n", (1.0-steadiest.Stability)*100)
+		fmt.Printf("Ranking strategy: %s\n", rankStrategy)
 	}
 	fmt.Println()
 
+	if len(rejected) > 0 {
+		fmt.Println(red("Rejected peers:"))
+		for _, p := range rejected {
+			fmt.Printf("  ✗ %s: %s\n", p.URI, p.Rejected)
+		}
+		fmt.Println()
+	}
+	if len(unverified) > 0 {
+		fmt.Println(yellow("Not ranked, the handshake couldn't be checked:"))
+		for _, p := range unverified {
+			fmt.Printf("  ? %s: %s\n", p.URI, p.VerifyError)
+		}
+		fmt.Println(yellow("Add these from 'Manual Peer Selection' if you want them."))
+		fmt.Println()
+	}
+
 	if len(ranked) == 0 {
-		fmt.Println(yellow("No reachable peers found with latency < 5s."))
+		fmt.Println(yellow(fmt.Sprintf("No usable Yggdrasil peers found with latency < %s.", probeConfig.MaxLatency)))
 		fmt.Println(yellow("This might mean:"))
 		fmt.Println(yellow("  - Network connectivity issues"))
 		fmt.Println(yellow("  - Firewall blocking connections"))
@@ -484,12 +713,15 @@ func autoAddPeers() {
 	}
 
 	// Show top 10 peers
-	displayCount := 10
+	displayCount := probeConfig.Show
 	if len(ranked) < displayCount {
 		displayCount = len(ranked)
 	}
 
-	fmt.Println(green("\nTop Peers by Latency & Stability:"))
+	fmt.Println(green("\nTop Peers (lower score is better):"))
+	if unverifiable > 0 {
+		fmt.Println(yellow("Peers marked unverified come after every verified peer, whatever their score."))
+	}
 	for i := 0; i < displayCount; i++ {
 		stability := "excellent"
 		stabilityPercent := (1.0 - ranked[i].Stability) * 100
@@ -503,9 +735,32 @@ func autoAddPeers() {
 			stability = "unstable"
 		}
 
-		fmt.Printf("%d. %s\n   Latency: %s (min: %s, max: %s, jitter: %s) - %s (%.0f%%)\n",
-			i+1, ranked[i].URI, ranked[i].Latency, ranked[i].MinLatency,
-			ranked[i].MaxLatency, ranked[i].Jitter, stability, stabilityPercent)
+		fmt.Printf("%d. %s\n   Latency: p50 %s, p90 %s, p99 %s (min: %s, jitter: %s) - %s (%.0f%%)\n",
+			i+1, ranked[i].URI, roundLatency(ranked[i].Latency), roundLatency(ranked[i].P90),
+			roundLatency(ranked[i].P99), roundLatency(ranked[i].MinLatency),
+			roundLatency(ranked[i].Jitter), stability, stabilityPercent)
+		fmt.Printf("   Loss: %.0f%% (%d samples", ranked[i].Loss*100, ranked[i].Samples)
+		if ranked[i].Outliers > 0 {
+			fmt.Printf(", %d outliers dropped", ranked[i].Outliers)
+		}
+		fmt.Println(")")
+		if ranked[i].Handshake > 0 {
+			fmt.Printf("   Connect: %s, handshake: %s\n",
+				ranked[i].Connect.Round(time.Millisecond), ranked[i].Handshake.Round(time.Millisecond))
+		}
+		for _, f := range ranked[i].Families {
+			fmt.Printf("   %s\n", f.Summary())
+		}
+		if ranked[i].Unverifiable {
+			fmt.Printf("   %s\n", yellow("? Unverified: "+ranked[i].VerifyError))
+		} else {
+			fmt.Printf("   Yggdrasil %s, key %s\n", ranked[i].Protocol, shortKey(ranked[i].PublicKey))
+		}
+		if ranked[i].Feed != nil {
+			fmt.Printf("   Status feed: %s\n", ranked[i].Feed.Summary())
+		}
+		fmt.Printf("   Score %s\n", ranked[i].Score.Summary())
+		fmt.Printf("   Rank: %s\n", explainRank(ranked, i))
 	}
 	if len(ranked) > displayCount {
 		fmt.Printf("\n(+%d more peers available)\n", len(ranked)-displayCount)
@@ -555,35 +810,89 @@ func autoAddPeers() {
 		countToAdd = len(ranked)
 	}
 
+	// Keep one outage from taking every new link down
+	rules, ok := askSelectionRules()
+	if !ok {
+		return
+	}
+	resolveCtx, cancelResolve := interruptible(probeConfig.Timeout)
+	configured := describeConfigured(resolveCtx, getAllConfigPeers(), candidates)
+	cancelResolve()
+	picked, passedOver := selectDiverse(ranked, countToAdd, rules, configured)
+	if len(passedOver) > 0 {
+		fmt.Println(yellow("\nPassed over to spread the peers out:"))
+		for _, s := range passedOver {
+			fmt.Printf("  - %s: %s\n", s.Peer.URI, s.Reason)
+		}
+	}
+	if rules.DistinctNetworks {
+		for _, p := range unplacedPeers(picked) {
+			fmt.Printf("  ? %s: network not checked, its address isn't resolved here\n", p.URI)
+		}
+	}
+	if len(picked) < countToAdd {
+		fmt.Println(yellow(fmt.Sprintf("\nOnly %d of the ranked peers satisfy the selection rules.", len(picked))))
+		fill := false
+		survey.AskOne(&survey.Confirm{
+			Message: fmt.Sprintf("Fill the other %d slots with the next best peers anyway?", countToAdd-len(picked)),
+		}, &fill)
+		if fill {
+			picked = fillSelection(ranked, picked, countToAdd, configured)
+		}
+	}
+	if len(picked) == 0 {
+		waitEnter()
+		return
+	}
+
 	toAdd := []string{}
 	fmt.Println(green("\nPeers to add:"))
-	for i := 0; i < countToAdd; i++ {
-		fmt.Printf("%d. %s (%s avg, jitter: %s)\n", i+1, ranked[i].URI,
-			ranked[i].Latency, ranked[i].Jitter)
-		toAdd = append(toAdd, ranked[i].URI)
+	for i, p := range picked {
+		mark := ""
+		if p.Unverifiable {
+			mark = yellow(" unverified")
+		}
+		fmt.Printf("%d. %s (score %.2f: p50 %s, p90 %s, loss %.0f%%)%s\n", i+1, p.URI, p.Score.Total,
+			roundLatency(p.Latency), roundLatency(p.P90), p.Loss*100, mark)
+		toAdd = append(toAdd, p.URI)
+	}
+
+	pin := true
+	survey.AskOne(&survey.Confirm{
+		Message: "Pin their verified public keys (?key=) to guard against hijacking?",
+		Default: true,
+	}, &pin)
+	if pin {
+		for i := range toAdd {
+			if pinned, err := pinKey(toAdd[i], picked[i].PublicKey); err == nil {
+				toAdd[i] = pinned
+			}
+		}
 	}
 
 	confirm := false
 	survey.AskOne(&survey.Confirm{Message: "Confirm adding these peers?"}, &confirm)
 	if confirm {
-		addPeersToConfig(toAdd)
+		if err := addPeersToConfig(toAdd); err != nil {
+			fmt.Println(red("Failed to update config: "), err)
+			waitEnter()
+			return
+		}
 		restartServicePrompt()
 	}
 }
 
 func manualAddPeers() {
+	candidates, err := loadCandidates()
+	if err != nil {
+		fmt.Println(red("Error: "), err)
+		waitEnter()
+		return
+	}
+	regions, regionMap := groupByRegion(candidates)
 	for {
 		clearScreen()
-		regionMap, err := fetchPeersStructure()
-		if err != nil {
-			return
-		}
-		keys := []string{}
-		for k := range regionMap {
-			keys = append(keys, k)
-		}
-		sort.Strings(keys)
-		keys = append(keys, "Back")
+		keys := append(append([]string{}, regions...), "Back")
 
 		selReg := ""
 		err = survey.AskOne(&survey.Select{Message: "Region:", Options: keys}, &selReg)
@@ -591,32 +900,53 @@ func manualAddPeers() {
 			return
 		}
 
-		peers := fetchPeersFromURLs(regionMap[selReg])
-		if len(peers) == 0 {
+		if len(regionMap[selReg]) == 0 {
 			fmt.Println("No peers.")
 			waitEnter()
 			continue
 		}
+		header, rows, peers := candidateTable(regionMap[selReg])
+		fmt.Println(cyan("       " + header))
+		var picked []int
+		err = survey.AskOne(&survey.MultiSelect{Message: "Select Peers:", Options: rows, PageSize: 20}, &picked)
 		selPeers := []string{}
-		err = survey.AskOne(&survey.MultiSelect{Message: "Select Peers:", Options: peers}, &selPeers)
+		for _, i := range picked {
+			selPeers = append(selPeers, peers[i].URI)
+		}
 		if err == nil && len(selPeers) > 0 {
-			addPeersToConfig(selPeers)
+			if err := addPeersToConfig(selPeers); err != nil {
+				fmt.Println(red("Failed to update config: "), err)
+				waitEnter()
+				continue
+			}
 			restartServicePrompt()
 		}
 	}
 }
 
 func removePeersMenu() {
-	current := getConfigPeers()
+	current := getAllConfigPeers()
 	if len(current) == 0 {
 		fmt.Println(yellow("No peers in config."))
 		waitEnter()
 		return
 	}
-	toRemove := []string{}
-	err := survey.AskOne(&survey.MultiSelect{Message: "Select to Remove:", Options: current}, &toRemove)
-	if err == nil && len(toRemove) > 0 {
-		removePeersFromConfig(toRemove)
+	labels := []string{}
+	for _, p := range current {
+		labels = append(labels, p.Label())
+	}
+	picked := []int{}
+	err := survey.AskOne(&survey.MultiSelect{Message: "Select to Remove:", Options: labels}, &picked)
+	if err == nil && len(picked) > 0 {
+		toRemove := []ConfiguredPeer{}
+		for _, i := range picked {
+			toRemove = append(toRemove, current[i])
+		}
+		if err := removeConfiguredPeers(toRemove); err != nil {
+			fmt.Println(red("Failed to update config: "), err)
+			waitEnter()
+			return
+		}
 		restartServicePrompt()
 	}
 }
@@ -625,154 +955,103 @@ func addCustomPeer() {
 	input := ""
 	err := survey.AskOne(&survey.Input{Message: "Enter URIs (space separated):"}, &input)
 	if err == nil && input != "" {
-		addPeersToConfig(strings.Fields(input))
+		iface, ok := askPeerTarget("Add to:")
+		if !ok {
+			return
+		}
+		if err := addPeersToList(iface, strings.Fields(input)); err != nil {
+			fmt.Println(red("Failed to update config: "), err)
+			waitEnter()
+			return
+		}
 		restartServicePrompt()
 	}
 }
 
-// --- Logic: Config Writer V4 (Clean formatting) ---
+// --- Logic: Config Peers ---
 
 func getConfigPeers() []string {
-	contentBytes, err := os.ReadFile(detectedConfigPath)
+	cfg, err := loadConfig(detectedConfigPath)
 	if err != nil {
 		return []string{}
 	}
-	content := string(contentBytes)
-	var peers []string
-
-	startIdx := strings.Index(content, "Peers: [")
-	if startIdx == -1 {
-		return peers
-	}
-	// Look for closing bracket with proper indentation (not IPv6 bracket)
-	// Search for "\n  ]" or "\n]" which marks the end of the Peers array
-	endIdx := strings.Index(content[startIdx:], "\n  ]")
-	if endIdx == -1 {
-		// Try alternative formatting
-		endIdx = strings.Index(content[startIdx:], "\n]")
-	}
-	if endIdx == -1 {
-		return peers
-	}
-	endIdx += startIdx
+	return cfg.StringList("Peers")
+}
 
-	block := content[startIdx:endIdx]
-	// Improved regex to properly handle IPv6 addresses in square brackets
-	// Matches: protocol://hostname:port or protocol://[ipv6]:port
-	re := regexp.MustCompile(`(tcp|tls|quic|ws|wss|udp)://(\[[0-9a-fA-F:]+\]|[a-zA-Z0-9\.\-]+)(:[0-9]+)?`)
-	matches := re.FindAllString(block, -1)
-	if matches != nil {
-		peers = append(peers, matches...)
-	}
-	return peers
+func addPeersToConfig(newPeers []string) error {
+	return addPeersToList("", newPeers)
 }
 
-func addPeersToConfig(newPeers []string) {
-	contentBytes, err := os.ReadFile(detectedConfigPath)
+// addPeersToList adds peers to the global Peers list (iface "") or to the
+// InterfacePeers list of iface.
+func addPeersToList(iface string, newPeers []string) error {
+	cfg, err := loadConfig(detectedConfigPath)
 	if err != nil {
-		return
+		return err
 	}
-	content := string(contentBytes)
 
-	// Combine existing peers + new peers
-	existing := getConfigPeers()
+	// Combine existing peers + new peers. A peer whose endpoint is already
+	// configured is a duplicate even if its options differ.
+	existing := cfg.PeerList(iface)
 	finalList := existing
-	for _, p := range newPeers {
+	for _, raw := range newPeers {
+		p, err := parsePeerURI(raw)
+		if err != nil {
+			return err
+		}
 		isDup := false
-		for _, e := range existing {
-			if e == p {
+		for _, e := range finalList {
+			if samePeer(e, p.String()) {
 				isDup = true
 				break
 			}
 		}
 		if !isDup {
-			finalList = append(finalList, p)
-		}
-	}
-
-	// Rebuild the "Peers: [...]" block entirely
-	newBlock := "Peers: ["
-	for _, p := range finalList {
-		newBlock += fmt.Sprintf("\n  %s", p) // Indent 2 spaces
-	}
-	newBlock += "\n]"
-
-	// Inject into file
-	startIdx := strings.Index(content, "Peers: [")
-	if startIdx != -1 {
-		// Found existing block, replace it
-		// Look for properly formatted closing bracket (not IPv6 bracket)
-		closingPattern := "\n  ]"
-		endIdx := strings.Index(content[startIdx:], closingPattern)
-		if endIdx == -1 {
-			closingPattern = "\n]"
-			endIdx = strings.Index(content[startIdx:], closingPattern)
-		}
-		if endIdx != -1 {
-			// Skip past the entire closing pattern including the bracket
-			endIdx = startIdx + endIdx + len(closingPattern)
-			newContent := content[:startIdx] + newBlock + content[endIdx:]
-			os.WriteFile(detectedConfigPath, []byte(newContent), 0644)
-			fmt.Println(green("Peers added and config formatted."))
-			return
+			finalList = append(finalList, p.String())
 		}
 	}
 
-	// Block not found, append to end
-	f, _ := os.OpenFile(detectedConfigPath, os.O_APPEND|os.O_WRONLY, 0644)
-	f.WriteString("\n" + newBlock + "\n")
-	f.Close()
-	fmt.Println(green("Peers block appended."))
-}
-
-func removePeersFromConfig(toRemove []string) {
-	// Re-use logic: Get current -> Filter -> Re-add remaining
-	current := getConfigPeers()
-	var keep []string
-
-	for _, p := range current {
-		shouldRemove := false
-		for _, rem := range toRemove {
-			if p == rem {
-				shouldRemove = true
-				break
-			}
-		}
-		if !shouldRemove {
-			keep = append(keep, p)
-		}
+	cfg.SetPeerList(iface, finalList)
+	if err := cfg.Save(); err != nil {
+		return err
 	}
+	fmt.Println(green("Peers added to config."))
+	return nil
+}
 
-	// Reconstruct the block manually to overwrite file
-	contentBytes, err := os.ReadFile(detectedConfigPath)
+// removeConfiguredPeers removes each peer from the list it was found in.
+func removeConfiguredPeers(toRemove []ConfiguredPeer) error {
+	cfg, err := loadConfig(detectedConfigPath)
 	if err != nil {
-		return
+		return err
 	}
-	content := string(contentBytes)
 
-	newBlock := "Peers: ["
-	for _, p := range keep {
-		newBlock += fmt.Sprintf("\n  %s", p)
+	byList := make(map[string][]string)
+	for _, p := range toRemove {
+		byList[p.Interface] = append(byList[p.Interface], p.URI)
 	}
-	newBlock += "\n  ]\n"
-
-	startIdx := strings.Index(content, "Peers: [")
-	if startIdx != -1 {
-		// Look for properly formatted closing bracket (not IPv6 bracket)
-		closingPattern := "\n  ]"
-		endIdx := strings.Index(content[startIdx:], closingPattern)
-		if endIdx == -1 {
-			closingPattern = "\n]"
-			endIdx = strings.Index(content[startIdx:], closingPattern)
-		}
-		if endIdx != -1 {
-			// Skip past the entire closing pattern including the bracket
-			endIdx = startIdx + endIdx + len(closingPattern)
-			newContent := content[:startIdx] + newBlock + content[endIdx:]
-			os.WriteFile(detectedConfigPath, []byte(newContent), 0644)
-			fmt.Println(green("Peers removed."))
+	for iface, uris := range byList {
+		var keep []string
+		for _, p := range cfg.PeerList(iface) {
+			shouldRemove := false
+			for _, rem := range uris {
+				if samePeer(p, rem) {
+					shouldRemove = true
+					break
+				}
+			}
+			if !shouldRemove {
+				keep = append(keep, p)
+			}
 		}
+		cfg.SetPeerList(iface, keep)
 	}
+
+	if err := cfg.Save(); err != nil {
+		return err
+	}
+	fmt.Println(green("Peers removed."))
+	return nil
 }
 
 // --- Helpers ---
@@ -791,121 +1070,195 @@ func restartServicePrompt() {
 	r := false
 	survey.AskOne(&survey.Confirm{Message: "Restart Yggdrasil service now?"}, &r)
 	if r {
-		if err := currentPlatform.ManageService("Restart"); err != nil {
-			fmt.Println(red("Restart failed: "), err)
-		} else {
-			fmt.Println(green("Service restarted."))
-		}
+		restartAndVerify()
+		waitEnter()
 	}
 }
 
 // pingPeerDetailed performs comprehensive latency testing with stability metrics.
-// It performs multiple attempts (5 by default) and calculates:
-// - Average latency
+// It probes until the Sampler is satisfied (5 to 15 times by default) and,
+// after dropping outliers, calculates:
+// - Median, p90 and p99 latency
 // - Minimum and maximum latency
 // - Jitter (standard deviation)
+// - Loss rate
 // - Stability score (0-1, where lower is better)
 //
 // This is crucial for mesh networks like Yggdrasil where peer quality and
 // stability matter significantly for routing performance.
 //
 // Parameters:
-//   - uri: The peer URI in format "protocol://host:port"
+//   - uri: The peer URI in format "protocol://host:port?options"
 //
 // Returns:
 //   - Peer struct with detailed metrics
 //   - High latency (999s) and poor stability if URI is invalid or all attempts fail
-func pingPeerDetailed(uri string) Peer {
-	parts := strings.Split(uri, "://")
-	if len(parts) < 2 {
+func pingPeerDetailed(ctx context.Context, uri string) Peer {
+	peerURI, err := parsePeerURI(uri)
+	if err != nil {
 		return Peer{
 			URI:       uri,
 			Latency:   999 * time.Second,
 			Stability: 1.0,
 		}
 	}
+	prober := proberFor(peerURI.Scheme)
 
-	// Perform multiple attempts for statistical accuracy
-	// More attempts = better data for stability analysis
-	attempts := 5
-	latencies := make([]time.Duration, 0, attempts)
+	groups, err := familyGroups(ctx, peerURI)
+	if err != nil {
+		return Peer{
+			URI:       uri,
+			Latency:   999 * time.Second,
+			Stability: 1.0,
+			LastError: "resolve: " + err.Error(),
+		}
+	}
+	if groups == nil {
+		peer := probeTargets(ctx, prober, uri, []*PeerURI{peerURI})
+		if peer.succeeded > 0 {
+			verifyPeer(ctx, &peer.Peer, peerURI)
+		}
+		return peer.Peer
+	}
 
-	for i := 0; i < attempts; i++ {
-		start := time.Now()
-		conn, err := net.DialTimeout("tcp", parts[1], 3*time.Second)
-		if err != nil {
-			// If connection fails, try next attempt
+	// Probe each address family on its own and keep the best one's numbers
+	var best *probedPeer
+	var bestTarget *PeerURI
+	var skipped []string
+	for i := range groups {
+		g := &groups[i]
+		if g.Skipped != "" {
+			skipped = append(skipped, g.Family+" "+g.Skipped)
 			continue
 		}
-		latency := time.Since(start)
-		conn.Close()
-
-		latencies = append(latencies, latency)
-
-		// Longer delay between attempts for more realistic measurements
-		// This helps detect connection instability
-		if i < attempts-1 {
-			time.Sleep(150 * time.Millisecond)
+		targets := g.targets(peerURI)
+		peer := probeTargets(ctx, prober, uri, targets)
+		g.Tried, g.OK, g.Error = peer.tried, peer.succeeded, peer.LastError
+		if g.OK == 0 {
+			continue
+		}
+		g.Latency = peer.Latency
+		if best == nil || peer.Latency < best.Latency {
+			best, bestTarget = &peer, targets[0]
 		}
 	}
-
-	// If all attempts failed, return poor metrics
-	if len(latencies) == 0 {
-		return Peer{
+	if best == nil {
+		peer := Peer{
 			URI:       uri,
 			Latency:   999 * time.Second,
 			Stability: 1.0,
+			Families:  groups,
+		}
+		for _, g := range groups {
+			if g.Error != "" {
+				peer.LastError = g.Error
+			}
+		}
+		if peer.LastError == "" {
+			peer.LastError = "no usable address: " + strings.Join(skipped, ", ")
 		}
+		return peer
 	}
+	best.Families = groups
+	verifyPeer(ctx, &best.Peer, bestTarget)
+	return best.Peer
+}
+
+// probedPeer is a Peer with the probe counts it was computed from.
+type probedPeer struct {
+	Peer
+	succeeded int
+	tried     int
+}
 
-	// Calculate statistics
-	var totalLatency time.Duration
-	minLatency := latencies[0]
-	maxLatency := latencies[0]
+// probeTargets probes a peer, taking the given addresses in turn, until
+// the sampler has enough data, and computes its latency and stability.
+func probeTargets(ctx context.Context, prober Prober, uri string, targets []*PeerURI) probedPeer {
+	sampler := newSampler()
+	var connectTotal, handshakeTotal time.Duration
+	lastError := ""
 
-	for _, lat := range latencies {
-		totalLatency += lat
-		if lat < minLatency {
-			minLatency = lat
+	for i := 0; !sampler.Done() && ctx.Err() == nil; i++ {
+		res, err := prober.Probe(ctx, targets[i%len(targets)], probeConfig.Timeout)
+		if err != nil {
+			lastError = err.Error()
+			sampler.Lose()
+		} else {
+			connectTotal += res.Connect
+			handshakeTotal += res.Handshake
+			sampler.Add(res.Total())
 		}
-		if lat > maxLatency {
-			maxLatency = lat
+
+		// Spacing the probes out helps detect connection instability
+		if !sampler.Done() {
+			select {
+			case <-time.After(probeConfig.Gap):
+			case <-ctx.Done():
+			}
 		}
 	}
 
-	avgLatency := totalLatency / time.Duration(len(latencies))
-
-	// Calculate standard deviation (jitter)
-	var variance float64
-	for _, lat := range latencies {
-		diff := float64(lat - avgLatency)
-		variance += diff * diff
+	st := sampler.Stats()
+	succeeded := st.Samples + st.Outliers
+	// If all attempts failed, return poor metrics
+	if succeeded == 0 {
+		return probedPeer{
+			Peer: Peer{
+				URI:       uri,
+				Latency:   999 * time.Second,
+				Stability: 1.0,
+				Loss:      1,
+				LastError: lastError,
+			},
+			tried: sampler.Tries(),
+		}
 	}
-	variance /= float64(len(latencies))
-	// Correctly calculate standard deviation (jitter) - need square root!
-	stdDev := math.Sqrt(variance)
-	jitter := time.Duration(stdDev)
 
-	// Calculate stability score (0 = perfect, 1 = terrible)
-	// Based on coefficient of variation (jitter relative to average latency)
+	// Stability score (0 = perfect, 1 = terrible): the coefficient of
+	// variation of the samples kept, capped at 1
 	stability := 0.0
-	if avgLatency > 0 {
-		// Coefficient of variation as stability metric
-		stability = stdDev / float64(avgLatency)
-		// Cap at 1.0 for extremely unstable connections
-		if stability > 1.0 {
-			stability = 1.0
-		}
-	}
+	if st.Mean > 0 {
+		stability = math.Min(float64(st.StdDev)/float64(st.Mean), 1.0)
+	}
+
+	peer := Peer{
+		URI:        uri,
+		Latency:    st.P50,
+		MinLatency: st.Min,
+		MaxLatency: st.Max,
+		Jitter:     st.StdDev,
+		Stability:  stability,
+		P90:        st.P90,
+		P99:        st.P99,
+		Loss:       st.Loss(),
+		Samples:    st.Samples,
+		Outliers:   st.Outliers,
+		Connect:    connectTotal / time.Duration(succeeded),
+		Handshake:  handshakeTotal / time.Duration(succeeded),
+		LastError:  lastError,
+	}
+	return probedPeer{Peer: peer, succeeded: succeeded, tried: sampler.Tries()}
+}
 
-	return Peer{
-		URI:             uri,
-		Latency:         avgLatency,
-		MinLatency:      minLatency,
-		MaxLatency:      maxLatency,
-		Jitter:          jitter,
-		Stability:       stability,
-		YggdrasilStatus: false,
+// verifyPeer runs the Yggdrasil handshake against a reachable peer and
+// records the outcome.
+func verifyPeer(ctx context.Context, peer *Peer, peerURI *PeerURI) {
+	meta, err := verifyYggdrasil(ctx, peerURI, probeConfig.Timeout)
+	if meta != nil {
+		peer.PublicKey = meta.KeyHex()
+		peer.Protocol = meta.Version()
+	}
+	var notYgg *NotYggdrasilError
+	switch {
+	case err == nil:
+		peer.YggdrasilStatus = true
+	case errors.As(err, &notYgg):
+		peer.Rejected = notYgg.Reason
+	case errors.Is(err, errUnverifiable):
+		peer.Unverifiable = true
+		peer.VerifyError = err.Error()
+	default:
+		peer.VerifyError = err.Error()
 	}
 }
 
@@ -928,66 +1281,48 @@ func checkActivePeersStatus() {
 	}
 
 	fmt.Println(string(out))
+	live, _ := getLivePeers()
+	printKeyMismatches(getAllConfigPeers(), live)
 	fmt.Println(yellow("\nTip: Use 'Remove Dead Peers' to clean up peers with 'Down' status."))
 	waitEnter()
 }
 
-// removeDeadPeers removes peers that are currently in "Down" state
-func removeDeadPeers() {
-	clearScreen()
-	fmt.Println(cyan("=== Remove Dead Peers ===\n"))
+// PeerStatus is one peer connection as reported by "yggdrasilctl getPeers"
+type PeerStatus struct {
+	URI       string
+	Up        bool
+	Inbound   bool
+	Key       string // Remote public key (hex)
+	LastError string
+}
+
+var errNoPeerData = errors.New("no peer data in getPeers response")
 
+// getLivePeers asks the running service for its peer connections
+func getLivePeers() ([]PeerStatus, error) {
 	cmdName := linuxExe
 	if isWindows {
 		cmdName = windowsExe
 	}
 
-	// Get current peer status from yggdrasilctl
-	fmt.Println("Fetching peer status from Yggdrasil...")
 	out, err := exec.Command(cmdName, "-json", "getPeers").CombinedOutput()
 	if err != nil {
-		fmt.Println(red("Error getting peer status: "), err)
-		fmt.Println(yellow("Make sure Yggdrasil service is running."))
-		waitEnter()
-		return
+		return nil, err
 	}
 
 	// Parse the JSON response - it's a map with "peers" array
 	var result map[string]interface{}
 	if err := json.Unmarshal(out, &result); err != nil {
-		fmt.Println(red("Error parsing peers data: "), err)
-		waitEnter()
-		return
+		return nil, fmt.Errorf("error parsing peers data: %v", err)
 	}
 
 	// Get the peers array
 	peersData, ok := result["peers"].([]interface{})
 	if !ok {
-		fmt.Println(yellow("No peer data found in response."))
-		fmt.Println(yellow("Make sure Yggdrasil service is running and has been started with some peers."))
-		waitEnter()
-		return
+		return nil, errNoPeerData
 	}
 
-	if len(peersData) == 0 {
-		fmt.Println(yellow("No active peer connections found."))
-		fmt.Println(yellow("Yggdrasil might still be starting up or no peers are configured."))
-		waitEnter()
-		return
-	}
-
-	fmt.Printf("\nFound %d peer connection(s) in Yggdrasil. Analyzing...\n\n", len(peersData))
-
-	// Parse peer statuses
-	type PeerStatus struct {
-		URI       string
-		Up        bool
-		LastError string
-	}
-
-	var upPeers []PeerStatus
-	var downPeers []PeerStatus
-
+	statuses := []PeerStatus{}
 	for _, peerInterface := range peersData {
 		peer, ok := peerInterface.(map[string]interface{})
 		if !ok {
@@ -1003,16 +1338,60 @@ func removeDeadPeers() {
 			continue // Skip if no URI
 		}
 
-		// Get up status
 		if up, ok := peer["up"].(bool); ok {
 			status.Up = up
 		}
+		if inbound, ok := peer["inbound"].(bool); ok {
+			status.Inbound = inbound
+		}
+		if key, ok := peer["key"].(string); ok {
+			status.Key = strings.ToLower(key)
+		}
 
 		// Get last error if exists
 		if lastError, ok := peer["last_error"].(string); ok {
 			status.LastError = lastError
 		}
 
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// removeDeadPeers removes peers that are currently in "Down" state
+func removeDeadPeers() {
+	clearScreen()
+	fmt.Println(cyan("=== Remove Dead Peers ===\n"))
+
+	// Get current peer status from yggdrasilctl
+	fmt.Println("Fetching peer status from Yggdrasil...")
+	peersData, err := getLivePeers()
+	if err == errNoPeerData {
+		fmt.Println(yellow("No peer data found in response."))
+		fmt.Println(yellow("Make sure Yggdrasil service is running and has been started with some peers."))
+		waitEnter()
+		return
+	}
+	if err != nil {
+		fmt.Println(red("Error getting peer status: "), err)
+		fmt.Println(yellow("Make sure Yggdrasil service is running."))
+		waitEnter()
+		return
+	}
+
+	if len(peersData) == 0 {
+		fmt.Println(yellow("No active peer connections found."))
+		fmt.Println(yellow("Yggdrasil might still be starting up or no peers are configured."))
+		waitEnter()
+		return
+	}
+
+	fmt.Printf("\nFound %d peer connection(s) in Yggdrasil. Analyzing...\n\n", len(peersData))
+
+	var upPeers []PeerStatus
+	var downPeers []PeerStatus
+
+	for _, status := range peersData {
 		if status.Up {
 			upPeers = append(upPeers, status)
 		} else {
@@ -1046,24 +1425,33 @@ func removeDeadPeers() {
 	}
 	fmt.Println()
 
-	// Get configured peers to see which ones are in config
-	configuredPeers := getConfigPeers()
+	// Get configured peers (global and per-interface) to see which ones are in config
+	configuredPeers := getAllConfigPeers()
+	printKeyMismatches(configuredPeers, peersData)
 
 	// Find which dead peers are actually in the config
-	var deadPeersInConfig []string
+	var deadPeersInConfig []ConfiguredPeer
 	var deadPeersNotInConfig []string
 
 	for _, deadPeer := range downPeers {
 		found := false
 		for _, configPeer := range configuredPeers {
-			if configPeer == deadPeer.URI {
-				found = true
-				break
+			if !samePeer(configPeer.URI, deadPeer.URI) {
+				continue
+			}
+			found = true
+			isDup := false
+			for _, p := range deadPeersInConfig {
+				if p == configPeer {
+					isDup = true
+					break
+				}
+			}
+			if !isDup {
+				deadPeersInConfig = append(deadPeersInConfig, configPeer)
 			}
 		}
-		if found {
-			deadPeersInConfig = append(deadPeersInConfig, deadPeer.URI)
-		} else {
+		if !found {
 			deadPeersNotInConfig = append(deadPeersNotInConfig, deadPeer.URI)
 		}
 	}
@@ -1085,15 +1473,19 @@ func removeDeadPeers() {
 
 	// Ask for confirmation
 	fmt.Printf("Found %s dead peers in config:\n", red(fmt.Sprintf("%d", len(deadPeersInConfig))))
-	for i, uri := range deadPeersInConfig {
-		fmt.Printf("%d. %s\n", i+1, uri)
+	for i, p := range deadPeersInConfig {
+		fmt.Printf("%d. %s\n", i+1, p.Label())
 	}
 	fmt.Println()
 
 	confirm := false
 	survey.AskOne(&survey.Confirm{Message: "Remove these dead peers from config?"}, &confirm)
 	if confirm {
-		removePeersFromConfig(deadPeersInConfig)
+		if err := removeConfiguredPeers(deadPeersInConfig); err != nil {
+			fmt.Println(red("Failed to update config: "), err)
+			waitEnter()
+			return
+		}
 		fmt.Println(green("\n✓ Dead peers removed from config."))
 		restartServicePrompt()
 	}
@@ -1118,44 +1510,44 @@ func getLinuxDistroInfo() (id string, like string) {
 	return strings.ToLower(id), strings.ToLower(like)
 }
 
+// getLatestReleaseURL always asks api.github.com: a custom API base only
+// mirrors the public-peers repository, not the Yggdrasil releases.
 func getLatestReleaseURL(repo, suffix, archFilter string) (string, error) {
-	resp, err := http.Get(fmt.Sprintf("https://api.github.com/repos/%s/%s/releases/latest", repoOwner, repo))
+	req, err := newRequest(context.Background(), fmt.Sprintf("%s/repos/%s/%s/releases/latest", defaultGitHubAPI, repoOwner, repo))
+	if err != nil {
+		return "", err
+	}
+	resp, err := httpClient.Do(req)
 	if err != nil {
 		return "", err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
-		return "", fmt.Errorf("github api returned %d", resp.StatusCode)
+		return "", responseError(resp)
 	}
 
-	var res map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+	var release GitRelease
+	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
 		return "", err
 	}
-
-	assets, ok := res["assets"].([]interface{})
-	if !ok {
+	if len(release.Assets) == 0 {
 		return "", fmt.Errorf("no assets found")
 	}
 
-	for _, a := range assets {
-		m := a.(map[string]interface{})
-		name, nameOk := m["name"].(string)
-		url, urlOk := m["browser_download_url"].(string)
-
-		if nameOk && urlOk && strings.HasSuffix(name, suffix) {
-			if archFilter != "" && !strings.Contains(strings.ToLower(name), strings.ToLower(archFilter)) {
+	for _, a := range release.Assets {
+		if a.URL != "" && strings.HasSuffix(a.Name, suffix) {
+			if archFilter != "" && !strings.Contains(strings.ToLower(a.Name), strings.ToLower(archFilter)) {
 				continue
 			}
-			return url, nil
+			return a.URL, nil
 		}
 	}
 	return "", fmt.Errorf("release not found for arch: %s", archFilter)
 }
 
 func downloadFile(path, url string) error {
-	resp, err := http.Get(url)
+	resp, err := downloadClient.Get(url)
 	if err != nil {
 		return err
 	}
@@ -1180,6 +1572,17 @@ func fileExists(p string) bool {
 	return !info.IsDir()
 }
 
+// interruptible returns a context that ends on Ctrl-C or after timeout.
+// While it is live, Ctrl-C no longer kills the program.
+func interruptible(timeout time.Duration) (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	return ctx, func() {
+		cancel()
+		stop()
+	}
+}
+
 func waitEnter() {
 	fmt.Println("\nPress Enter...")
 	bufio.NewReader(os.Stdin).ReadBytes('\n')
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// --- Public Peers Markdown ---
+
+// PeerRecord is one host entry of a public-peers markdown file: the URIs it
+// offers and whatever the list says about it.
+type PeerRecord struct {
+	Region   string
+	Country  string
+	Operator string
+	Notes    string
+	URIs     []string
+}
+
+var (
+	mdListItemRe = regexp.MustCompile(`^(\s*)[*+-]\s+(.*)$`)
+	mdHeadingRe  = regexp.MustCompile(`^#{1,3}\s+(.+)$`)
+	mdLinkRe     = regexp.MustCompile(`\[([^\]]*)\]\([^)]*\)`)
+	mdOperatorRe = regexp.MustCompile(`(?i)\b(?:operated|maintained|run|hosted|provided|managed)\s+by:?\s+([^,;()|]+)`)
+)
+
+// countryFromFile turns "united-kingdom.md" into "United Kingdom".
+func countryFromFile(file string) string {
+	name := strings.TrimSuffix(path.Base(file), path.Ext(file))
+	words := strings.FieldsFunc(name, func(r rune) bool { return r == '-' || r == '_' || r == ' ' })
+	for i, w := range words {
+		r, size := utf8.DecodeRuneInString(w)
+		words[i] = string(unicode.ToUpper(r)) + w[size:]
+	}
+	return strings.Join(words, " ")
+}
+
+// cleanMarkdown reduces inline markdown to plain text and removes the
+// given URIs from it.
+func cleanMarkdown(s string, uris []string) string {
+	s = mdLinkRe.ReplaceAllString(s, "$1")
+	for _, uri := range uris {
+		s = strings.ReplaceAll(s, uri, "")
+	}
+	s = strings.NewReplacer("`", "", "**", "", "<br>", " ").Replace(s)
+	s = strings.Join(strings.Fields(s), " ")
+	return strings.Trim(s, " ,;:-|")
+}
+
+func operatorOf(notes string) string {
+	if m := mdOperatorRe.FindStringSubmatch(notes); m != nil {
+		return strings.TrimSpace(m[1])
+	}
+	return ""
+}
+
+// parsePeerMarkdown reads one public-peers file. Hosts are written either
+// as a top-level list item describing the host followed by nested items with
+// its URIs, as list items holding URIs directly, or as table rows.
+func parsePeerMarkdown(region, file, text string) []PeerRecord {
+	country := countryFromFile(file)
+	var records []PeerRecord
+	current := -1 // Index of the host whose nested URIs are being read
+
+	newRecord := func(notes string, uris []string) int {
+		records = append(records, PeerRecord{
+			Region:   region,
+			Country:  country,
+			Operator: operatorOf(notes),
+			Notes:    notes,
+			URIs:     uris,
+		})
+		return len(records) - 1
+	}
+
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if m := mdHeadingRe.FindStringSubmatch(line); m != nil && len(records) == 0 {
+			if h := cleanMarkdown(m[1], nil); h != "" && !strings.Contains(strings.ToLower(h), "peers") {
+				country = h
+			}
+			continue
+		}
+		uris := findPeerURIs(line)
+
+		if strings.HasPrefix(strings.TrimSpace(line), "|") {
+			current = -1
+			if len(uris) > 0 {
+				newRecord(cleanMarkdown(line, uris), uris)
+			}
+			continue
+		}
+
+		m := mdListItemRe.FindStringSubmatch(line)
+		if m == nil {
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			if len(uris) > 0 {
+				if current != -1 && line[0] == ' ' {
+					records[current].URIs = append(records[current].URIs, uris...)
+				} else {
+					current = -1
+					newRecord(cleanMarkdown(line, uris), uris)
+				}
+			}
+			continue
+		}
+
+		nested := len(m[1]) > 0
+		switch {
+		case nested && current != -1:
+			rec := &records[current]
+			rec.URIs = append(rec.URIs, uris...)
+			if note := cleanMarkdown(m[2], uris); note != "" {
+				if rec.Notes != "" {
+					note = rec.Notes + "; " + note
+				}
+				rec.Notes = note
+				rec.Operator = operatorOf(note)
+			}
+		case len(uris) > 0:
+			current = newRecord(cleanMarkdown(m[2], uris), uris)
+			if records[current].Notes == "" {
+				current = -1 // Only a described host may list more URIs below
+			}
+		default:
+			current = newRecord(cleanMarkdown(m[2], nil), nil)
+		}
+	}
+
+	// Drop descriptions that never got any URIs
+	var out []PeerRecord
+	for _, r := range records {
+		if len(r.URIs) > 0 {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// recordCandidates flattens records into one candidate per URI.
+func recordCandidates(records []PeerRecord) []PeerCandidate {
+	var out []PeerCandidate
+	for _, r := range records {
+		for _, uri := range r.URIs {
+			out = append(out, PeerCandidate{
+				URI:      uri,
+				Region:   r.Region,
+				Country:  r.Country,
+				Operator: r.Operator,
+				Notes:    r.Notes,
+			})
+		}
+	}
+	return out
+}
+
+// truncate shortens s to at most n runes, marking the cut with "…".
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n-1]) + "…"
+}
+
+// candidateTable formats candidates as aligned rows for a selection list,
+// sorted by country and operator, and returns the header and the rows in
+// the same order as the returned candidates.
+func candidateTable(candidates []PeerCandidate) (string, []string, []PeerCandidate) {
+	sorted := append([]PeerCandidate{}, candidates...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Country != sorted[j].Country {
+			return sorted[i].Country < sorted[j].Country
+		}
+		return sorted[i].Operator < sorted[j].Operator
+	})
+
+	uriWidth := 10
+	for _, c := range sorted {
+		if n := len([]rune(c.URI)); n > uriWidth {
+			uriWidth = n
+		}
+	}
+	if uriWidth > 60 {
+		uriWidth = 60
+	}
+	format := fmt.Sprintf("%%-%ds  %%-14s  %%-16s  %%s", uriWidth)
+	header := fmt.Sprintf(format, "URI", "COUNTRY", "OPERATOR", "NOTES")
+	var rows []string
+	for _, c := range sorted {
+		notes := c.Notes
+		if c.Operator != "" {
+			// The operator has its own column
+			notes = strings.Join(strings.Fields(mdOperatorRe.ReplaceAllString(notes, "")), " ")
+			notes = strings.NewReplacer(", ,", ",", ", ;", ";").Replace(notes)
+			notes = strings.Trim(notes, " ,;:-")
+		}
+		rows = append(rows, fmt.Sprintf(format,
+			truncate(c.URI, uriWidth), truncate(c.Country, 14), truncate(c.Operator, 16), truncate(notes, 40)))
+	}
+	return header, rows, sorted
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCountryFromFile(t *testing.T) {
+	for in, want := range map[string]string{
+		"united-kingdom.md":    "United Kingdom",
+		"europe/germany.md":    "Germany",
+		"åland_islands.md":     "Åland Islands",
+		"türkiye.md":           "Türkiye",
+		"côte-d'ivoire.md":     "Côte D'ivoire",
+		"méxico":               "México",
+		"asia/south-korea.md":  "South Korea",
+		"north-america/usa.md": "Usa",
+	} {
+		if got := countryFromFile(in); got != want {
+			t.Errorf("countryFromFile(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestParsePeerMarkdown(t *testing.T) {
+	text := "# Public peers\n\n## Deutschland\n\nThe peers below are public.\n\n" +
+		"* Berlin node, operated by Alice (1 Gbit/s)\n" +
+		"  * `tcp://192.0.2.1:9001`\n" +
+		"  * `tls://[2001:db8::1]:9002`\n" +
+		"    * `quic://192.0.2.1:9003` (experimental)\n" +
+		"* `tls://198.51.100.7:443` maintained by: Bob\n" +
+		"\n| URI | Operator | Notes |\n|---|---|---|\n" +
+		"| `tcp://203.0.113.5:12345` | hosted by Carol | 100 Mbit/s |\n" +
+		"| [tls://203.0.113.6:443](tls://203.0.113.6:443) | run by Dave | IPv4 only |\n" +
+		"\n### Retired\n\n* Old host with no peers listed\n"
+	want := []PeerRecord{
+		{
+			Operator: "Alice",
+			Notes:    "Berlin node, operated by Alice (1 Gbit/s); (experimental)",
+			URIs:     []string{"tcp://192.0.2.1:9001", "tls://[2001:db8::1]:9002", "quic://192.0.2.1:9003"},
+		},
+		{Operator: "Bob", Notes: "maintained by: Bob", URIs: []string{"tls://198.51.100.7:443"}},
+		{Operator: "Carol", Notes: "hosted by Carol | 100 Mbit/s", URIs: []string{"tcp://203.0.113.5:12345"}},
+		{Operator: "Dave", Notes: "run by Dave | IPv4 only", URIs: []string{"tls://203.0.113.6:443"}},
+	}
+	for i := range want {
+		want[i].Region, want[i].Country = "europe", "Deutschland"
+	}
+	got := parsePeerMarkdown("europe", "europe/germany.md", text)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parsePeerMarkdown() =\n%#v\nwant\n%#v", got, want)
+	}
+}
+
+func TestParsePeerMarkdownHeadings(t *testing.T) {
+	for _, tt := range []struct {
+		text, want string
+	}{
+		{"# Germany\n* tcp://192.0.2.1:1\n", "Germany"},
+		{"### **Germany**\n* tcp://192.0.2.1:1\n", "Germany"},
+		{"#### Germany\n* tcp://192.0.2.1:1\n", "De"},
+		{"## Public Peers\n* tcp://192.0.2.1:1\n", "De"},
+		{"* tcp://192.0.2.1:1\n# Germany\n", "De"},
+	} {
+		records := parsePeerMarkdown("europe", "de.md", tt.text)
+		if len(records) != 1 || records[0].Country != tt.want {
+			t.Errorf("parsePeerMarkdown(%q) = %+v, want country %q", tt.text, records, tt.want)
+		}
+	}
+}
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/AlecAivazis/survey/v2"
+	"github.com/AlecAivazis/survey/v2/terminal"
+)
+
+// --- Multicast Discovery ---
+
+// MulticastEntry is one item of MulticastInterfaces, read with Yggdrasil's
+// defaults for missing keys.
+type MulticastEntry struct {
+	Regex    string
+	Beacon   bool
+	Listen   bool
+	Port     int
+	Priority int
+	Password string
+}
+
+func readMulticastEntry(n *Node) MulticastEntry {
+	return MulticastEntry{
+		Regex:    n.Member("Regex").Str(),
+		Beacon:   n.Member("Beacon").Bool(true),
+		Listen:   n.Member("Listen").Bool(true),
+		Port:     n.Member("Port").Int(0),
+		Priority: n.Member("Priority").Int(0),
+		Password: n.Member("Password").Str(),
+	}
+}
+
+func (e MulticastEntry) Summary() string {
+	flags := []string{}
+	if e.Beacon {
+		flags = append(flags, "beacon")
+	}
+	if e.Listen {
+		flags = append(flags, "listen")
+	}
+	if len(flags) == 0 {
+		flags = append(flags, "disabled")
+	}
+	s := fmt.Sprintf("/%s/ %s", e.Regex, strings.Join(flags, "+"))
+	if e.Port != 0 {
+		s += fmt.Sprintf(", port %d", e.Port)
+	}
+	if e.Priority != 0 {
+		s += fmt.Sprintf(", priority %d", e.Priority)
+	}
+	if e.Password != "" {
+		s += ", password set"
+	}
+	return s
+}
+
+// multicastNodes returns the MulticastInterfaces array, creating it if needed.
+func multicastNodes(cfg *Config) *Node {
+	n := cfg.Get("MulticastInterfaces")
+	if n == nil || n.Kind != NodeArray {
+		n = newArrayNode()
+		cfg.Set("MulticastInterfaces", n)
+	}
+	return n
+}
+
+// matchMulticastEntry returns the index of the first entry whose regex
+// matches the interface name, as Yggdrasil picks it, or -1. Like Yggdrasil,
+// it skips entries with neither beacon nor listen, so a later entry can
+// still apply.
+func matchMulticastEntry(entries []MulticastEntry, name string) int {
+	for i, e := range entries {
+		if !e.Beacon && !e.Listen {
+			continue
+		}
+		re, err := regexp.Compile(e.Regex)
+		if err != nil {
+			continue
+		}
+		if re.MatchString(name) {
+			return i
+		}
+	}
+	return -1
+}
+
+func printMulticastState(entries []MulticastEntry) {
+	if len(entries) == 0 {
+		fmt.Println(yellow("No MulticastInterfaces entries. LAN auto-peering is off."))
+	}
+	for i, e := range entries {
+		fmt.Printf("%d. %s\n", i+1, e.Summary())
+	}
+
+	fmt.Println(cyan("\nHost interfaces:"))
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		fmt.Println(red("Error listing interfaces: "), err)
+		return
+	}
+	for _, iface := range ifaces {
+		state := "down"
+		if iface.Flags&net.FlagUp != 0 {
+			state = "up"
+		}
+		if iface.Flags&net.FlagMulticast == 0 {
+			state += ", no multicast"
+		}
+		match := yellow("not matched")
+		if i := matchMulticastEntry(entries, iface.Name); i != -1 {
+			match = green(fmt.Sprintf("entry %d", i+1))
+		}
+		fmt.Printf("  %-16s %-20s %s\n", iface.Name, "("+state+")", match)
+	}
+}
+
+// printLiveMulticast shows what the running service is doing right now.
+func printLiveMulticast() {
+	out, err := yggdrasilctl("-json", "getMulticastInterfaces").Output()
+	if err != nil {
+		return
+	}
+	var result map[string]interface{}
+	if json.Unmarshal(out, &result) != nil {
+		return
+	}
+	fmt.Println(cyan("\nActive in the running service:"))
+	items, _ := result["multicast_interfaces"].([]interface{})
+	if len(items) == 0 {
+		fmt.Println(yellow("  none"))
+		return
+	}
+	for _, item := range items {
+		switch v := item.(type) {
+		case string:
+			fmt.Printf("  %s\n", v)
+		case map[string]interface{}:
+			name, _ := v["name"].(string)
+			addr, _ := v["address"].(string)
+			flags := []string{}
+			for _, f := range []string{"beacon", "listen", "password"} {
+				if on, _ := v[f].(bool); on {
+					flags = append(flags, f)
+				}
+			}
+			fmt.Printf("  %-16s %s %s\n", name, addr, strings.Join(flags, "+"))
+		}
+	}
+}
+
+func askMulticastRegex(def string) (string, bool) {
+	names := hostInterfaceNames()
+	regex := ""
+	err := survey.AskOne(&survey.Input{
+		Message: "Interface regex:",
+		Default: def,
+		Help:    "Interfaces on this host: " + strings.Join(names, ", "),
+	}, &regex, survey.WithValidator(func(ans interface{}) error {
+		_, err := regexp.Compile(ans.(string))
+		return err
+	}))
+	if err != nil || regex == "" {
+		return "", false
+	}
+
+	var matched []string
+	re := regexp.MustCompile(regex)
+	for _, n := range names {
+		if re.MatchString(n) {
+			matched = append(matched, n)
+		}
+	}
+	if len(matched) == 0 {
+		fmt.Println(yellow("Note: this regex matches no interface on this host right now."))
+	} else {
+		fmt.Printf("Matches: %s\n", strings.Join(matched, ", "))
+	}
+	return regex, true
+}
+
+func editMulticastEntry(entry *Node) bool {
+	for {
+		e := readMulticastEntry(entry)
+		action := ""
+		err := survey.AskOne(&survey.Select{
+			Message: "Edit " + e.Summary() + ":",
+			Options: []string{
+				fmt.Sprintf("Toggle Beacon (now %v)", e.Beacon),
+				fmt.Sprintf("Toggle Listen (now %v)", e.Listen),
+				"Change Regex",
+				fmt.Sprintf("Set Port (now %d)", e.Port),
+				fmt.Sprintf("Set Priority (now %d)", e.Priority),
+				"Done",
+			},
+		}, &action)
+		if err != nil {
+			return false
+		}
+
+		switch {
+		case strings.HasPrefix(action, "Toggle Beacon"):
+			entry.SetMember("Beacon", newBoolNode(!e.Beacon))
+		case strings.HasPrefix(action, "Toggle Listen"):
+			entry.SetMember("Listen", newBoolNode(!e.Listen))
+		case action == "Change Regex":
+			if regex, ok := askMulticastRegex(e.Regex); ok {
+				entry.SetMember("Regex", newStringNode(regex))
+			}
+		case strings.HasPrefix(action, "Set Port"):
+			if n, ok := askNumber("Port (0 = random):", e.Port, 0, 65535); ok {
+				entry.SetMember("Port", newNumberNode(n))
+			}
+		case strings.HasPrefix(action, "Set Priority"):
+			if n, ok := askNumber("Priority (0-255, lower is preferred):", e.Priority, 0, 255); ok {
+				entry.SetMember("Priority", newNumberNode(n))
+			}
+		case action == "Done":
+			return true
+		}
+	}
+}
+
+func askNumber(message string, def, min, max int) (int, bool) {
+	s := ""
+	err := survey.AskOne(&survey.Input{Message: message, Default: strconv.Itoa(def)}, &s,
+		survey.WithValidator(func(ans interface{}) error {
+			n, err := strconv.Atoi(ans.(string))
+			if err != nil || n < min || n > max {
+				return fmt.Errorf("enter a number between %d and %d", min, max)
+			}
+			return nil
+		}))
+	if err != nil {
+		return 0, false
+	}
+	n, _ := strconv.Atoi(s)
+	return n, true
+}
+
+func multicastMenu() {
+	for {
+		clearScreen()
+		fmt.Println(cyan("=== Multicast Discovery (LAN auto-peering) ===\n"))
+		cfg, err := loadConfig(detectedConfigPath)
+		if err != nil {
+			fmt.Println(red("Error: "), err)
+			waitEnter()
+			return
+		}
+		arr := multicastNodes(cfg)
+		var entries []MulticastEntry
+		for _, n := range arr.Children {
+			entries = append(entries, readMulticastEntry(n))
+		}
+		printMulticastState(entries)
+		printLiveMulticast()
+		fmt.Println()
+
+		action := ""
+		err = survey.AskOne(&survey.Select{
+			Message: "Multicast Menu (Esc to back):",
+			Options: []string{"Add Entry", "Edit Entry", "Remove Entry", "Set Shared Password", "Back"},
+		}, &action)
+		if err == terminal.InterruptErr || action == "Back" || action == "" {
+			return
+		}
+
+		changed := false
+		switch action {
+		case "Add Entry":
+			regex, ok := askMulticastRegex(".*")
+			if !ok {
+				continue
+			}
+			entry := newObjectNode()
+			entry.SetMember("Regex", newStringNode(regex))
+			entry.SetMember("Beacon", newBoolNode(true))
+			entry.SetMember("Listen", newBoolNode(true))
+			entry.SetMember("Port", newNumberNode(0))
+			entry.SetMember("Priority", newNumberNode(0))
+			password := ""
+			if len(entries) > 0 {
+				password = entries[0].Password
+			}
+			entry.SetMember("Password", newStringNode(password))
+			arr.Children = append(arr.Children, entry)
+			changed = editMulticastEntry(entry)
+		case "Edit Entry", "Remove Entry":
+			if len(entries) == 0 {
+				continue
+			}
+			options := []string{}
+			for _, e := range entries {
+				options = append(options, e.Summary())
+			}
+			idx := 0
+			if err := survey.AskOne(&survey.Select{Message: "Entry:", Options: options}, &idx); err != nil {
+				continue
+			}
+			if action == "Edit Entry" {
+				changed = editMulticastEntry(arr.Children[idx])
+			} else {
+				arr.Children = append(arr.Children[:idx], arr.Children[idx+1:]...)
+				changed = true
+			}
+		case "Set Shared Password":
+			password := ""
+			err := survey.AskOne(&survey.Password{
+				Message: "Password for all entries (empty to clear):",
+				Help:    "Only nodes with the same password will auto-peer over multicast.",
+			}, &password)
+			if err != nil {
+				continue
+			}
+			for _, n := range arr.Children {
+				n.SetMember("Password", newStringNode(password))
+			}
+			changed = true
+		}
+
+		if !changed {
+			continue
+		}
+		if err := cfg.Save(); err != nil {
+			fmt.Println(red("Failed to update config: "), err)
+			waitEnter()
+			continue
+		}
+		fmt.Println(green("Multicast settings saved."))
+		restartServicePrompt()
+	}
+}
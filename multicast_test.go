@@ -0,0 +1,26 @@
+package main
+
+import "testing"
+
+func TestMatchMulticastEntry(t *testing.T) {
+	entries := []MulticastEntry{
+		{Regex: "eth0"},
+		{Regex: "eth.*", Listen: true},
+		{Regex: "wl.*", Beacon: true, Listen: true},
+		{Regex: "(", Beacon: true},
+		{Regex: ".*", Beacon: true},
+	}
+	for name, want := range map[string]int{
+		"eth0":  1, // The disabled entry before it doesn't count
+		"eth1":  1,
+		"wlan0": 2,
+		"tun0":  4,
+	} {
+		if got := matchMulticastEntry(entries, name); got != want {
+			t.Errorf("matchMulticastEntry(%s) = %d, want %d", name, got, want)
+		}
+	}
+	if got := matchMulticastEntry(entries[:1], "eth0"); got != -1 {
+		t.Errorf("matchMulticastEntry() = %d with only a disabled entry, want -1", got)
+	}
+}
@@ -0,0 +1,704 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AlecAivazis/survey/v2"
+	"github.com/AlecAivazis/survey/v2/terminal"
+)
+
+// --- Peer Sources ---
+
+// PeerCandidate is a public peer offered by a source.
+type PeerCandidate struct {
+	URI      string
+	Region   string
+	Country  string
+	Operator string
+	Notes    string
+	Source   string
+	Feed     *FeedStatus // From a status feed, if one lists the peer
+}
+
+// PeerSource is somewhere public peers are listed.
+type PeerSource interface {
+	// Spec is the settings string the source was created from.
+	Spec() string
+	// Load returns the source's peers and, if they come from cached data
+	// because the source couldn't be reached, when that data was fresh.
+	Load(ctx context.Context) (out []PeerCandidate, stale time.Time, err error)
+}
+
+// sourceFlags holds --source values; they replace the saved sources.
+var sourceFlags []string
+
+// parsePeerSource turns a spec into a source. Specs are "github:owner/repo[@branch]",
+// "dir:PATH", "list:URL", "git:URL[@branch]" and "status:URL"; without a prefix, existing
+// directories and files, URLs ending in .git and other URLs are recognised.
+func parsePeerSource(spec string) (PeerSource, error) {
+	spec = strings.TrimSpace(spec)
+	kind, value, _ := strings.Cut(spec, ":")
+	switch kind {
+	case "github", "dir", "list", "git", "status":
+	default:
+		kind, value = "", spec
+		switch {
+		case strings.HasPrefix(spec, "http://") || strings.HasPrefix(spec, "https://"):
+			kind = "list"
+			if strings.HasSuffix(spec, ".git") {
+				kind = "git"
+			}
+		default:
+			if info, err := os.Stat(spec); err == nil {
+				kind = "list"
+				if info.IsDir() {
+					kind = "dir"
+				}
+			}
+		}
+	}
+	if value == "" {
+		return nil, fmt.Errorf("empty peer source")
+	}
+
+	switch kind {
+	case "github":
+		repo, branch, _ := strings.Cut(value, "@")
+		owner, name, ok := strings.Cut(repo, "/")
+		if !ok || owner == "" || name == "" {
+			return nil, fmt.Errorf("github source must be owner/repo[@branch]: %s", value)
+		}
+		if branch == "" {
+			branch = peerRepo.Branch
+		}
+		return &GitHubSource{Owner: owner, Repo: name, Branch: branch}, nil
+	case "dir":
+		return &DirSource{Path: value}, nil
+	case "list":
+		return &ListSource{URL: value}, nil
+	case "git":
+		url, branch := value, ""
+		if i := strings.LastIndex(value, "@"); i > strings.Index(value, "://")+3 && !strings.Contains(value[i:], "/") {
+			url, branch = value[:i], value[i+1:]
+		}
+		return &GitMirrorSource{URL: url, Branch: branch}, nil
+	case "status":
+		return &StatusFeedSource{URL: value}, nil
+	}
+	return nil, fmt.Errorf("unknown peer source %q (use github:, dir:, list:, git: or status:)", spec)
+}
+
+// configuredPeerSources returns the --source flags, the saved sources, or
+// the public-peers repository, in that order of preference.
+func configuredPeerSources() ([]PeerSource, error) {
+	specs := sourceFlags
+	if len(specs) == 0 {
+		settings, err := loadSettings()
+		if err != nil {
+			return nil, err
+		}
+		specs = settings.Sources
+	}
+	if len(specs) == 0 {
+		specs = defaultPeerSources()
+	}
+	var sources []PeerSource
+	for _, spec := range specs {
+		src, err := parsePeerSource(spec)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, src)
+	}
+	return sources, nil
+}
+
+// loadPeerCandidates loads every source and merges the results, keeping the
+// first entry for each endpoint but filling in details later sources know,
+// such as status feed data. Sources that fail are reported and skipped.
+func loadPeerCandidates(ctx context.Context, sources []PeerSource) ([]PeerCandidate, error) {
+	var merged []PeerCandidate
+	seen := map[string]int{}
+	failed := 0
+	var lastErr error
+	if offlineMode {
+		fmt.Println(yellow("Offline mode: using cached peer lists only."))
+	}
+	for _, src := range sources {
+		fmt.Printf("Loading peers from %s...\n", src.Spec())
+		found, stale, err := src.Load(ctx)
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("loading peers: %w", ctx.Err())
+		}
+		if err != nil {
+			fmt.Println(red("  Failed: "), err)
+			failed++
+			lastErr = err
+			continue
+		}
+		added := 0
+		for _, c := range found {
+			key := c.URI
+			if p, err := parsePeerURI(c.URI); err == nil {
+				key = p.Endpoint()
+			}
+			if i, ok := seen[key]; ok {
+				mergeCandidate(&merged[i], c)
+				continue
+			}
+			seen[key] = len(merged)
+			if c.Region == "" {
+				c.Region = "other"
+			}
+			c.Source = src.Spec()
+			merged = append(merged, c)
+			added++
+		}
+		if stale.IsZero() {
+			fmt.Printf("  %d peers (%d new)\n", len(found), added)
+		} else {
+			fmt.Printf("  %d peers (%d new) %s\n", len(found), added, yellow("from cache, updated "+formatAge(stale)))
+		}
+	}
+	if failed == len(sources) && lastErr != nil {
+		return nil, lastErr
+	}
+	return merged, nil
+}
+
+func mergeCandidate(dst *PeerCandidate, src PeerCandidate) {
+	if dst.Feed == nil {
+		dst.Feed = src.Feed
+	}
+	// Regions the first source didn't know were filed under "other"
+	if (dst.Region == "" || dst.Region == "other") && src.Region != "" {
+		dst.Region = src.Region
+	}
+	if dst.Country == "" {
+		dst.Country = src.Country
+	}
+	if dst.Operator == "" {
+		dst.Operator = src.Operator
+	}
+	if dst.Notes == "" {
+		dst.Notes = src.Notes
+	}
+}
+
+// groupByRegion returns the candidates' regions, sorted, and the candidates
+// in each.
+func groupByRegion(candidates []PeerCandidate) ([]string, map[string][]PeerCandidate) {
+	regionMap := map[string][]PeerCandidate{}
+	for _, c := range candidates {
+		regionMap[c.Region] = append(regionMap[c.Region], c)
+	}
+	var regions []string
+	for region := range regionMap {
+		regions = append(regions, region)
+	}
+	sort.Strings(regions)
+	return regions, regionMap
+}
+
+// fetchURLs downloads the given URLs, 10 at a time. Failed downloads are
+// left out of the result; stale is the oldest of the cached copies used.
+func fetchURLs(ctx context.Context, urls []string) (bodies map[string][]byte, stale time.Time) {
+	bodies = map[string][]byte{}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, 10)
+
+	for _, u := range urls {
+		wg.Add(1)
+		go func(url string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			body, cachedAt, err := httpGet(ctx, url)
+			if err == nil {
+				mu.Lock()
+				bodies[url] = body
+				stale = olderData(stale, cachedAt)
+				mu.Unlock()
+			}
+		}(u)
+	}
+	wg.Wait()
+	return bodies, stale
+}
+
+// isPeerListFile reports whether a path in a public-peers tree holds peers.
+func isPeerListFile(path string) bool {
+	return strings.HasSuffix(path, ".md") && !strings.HasSuffix(path, "README.md")
+}
+
+// GitHubSource reads a public-peers style repository through the GitHub API,
+// or the GitHub-compatible API at the configured base.
+type GitHubSource struct {
+	Owner, Repo, Branch string
+}
+
+func (s *GitHubSource) Spec() string {
+	return fmt.Sprintf("github:%s/%s@%s", s.Owner, s.Repo, s.Branch)
+}
+
+// Load reads the tree through the API and each peer list from
+// raw.githubusercontent.com. If the API fails, most often because of the
+// rate limit, or returns a truncated tree, the branch archive is downloaded
+// instead.
+func (s *GitHubSource) Load(ctx context.Context) ([]PeerCandidate, time.Time, error) {
+	out, stale, err := s.loadTree(ctx)
+	if err == nil || ctx.Err() != nil {
+		return out, stale, err
+	}
+	fmt.Println(yellow("  " + err.Error()))
+	fmt.Println(yellow("  Falling back to the repository archive..."))
+	return s.loadArchive(ctx)
+}
+
+func (s *GitHubSource) loadTree(ctx context.Context) ([]PeerCandidate, time.Time, error) {
+	body, treeStale, err := httpGet(ctx, s.treeURL())
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	var treeResp GitTreeResponse
+	if err := json.Unmarshal(body, &treeResp); err != nil {
+		return nil, time.Time{}, err
+	}
+	if treeResp.Truncated {
+		// Peer lists past the cut would go missing without a word
+		return nil, time.Time{}, fmt.Errorf("the tree of %s/%s is too large for the API", s.Owner, s.Repo)
+	}
+
+	pathOf := map[string]string{}
+	var urls []string
+	for _, node := range treeResp.Tree {
+		if node.Type != "blob" || !isPeerListFile(node.Path) {
+			continue
+		}
+		parts := strings.Split(node.Path, "/")
+		if len(parts) < 2 {
+			continue
+		}
+		rawUrl := s.fileURL(node.Path)
+		pathOf[rawUrl] = node.Path
+		urls = append(urls, rawUrl)
+	}
+	if len(urls) == 0 {
+		return nil, time.Time{}, fmt.Errorf("no peer lists found in %s/%s@%s", s.Owner, s.Repo, s.Branch)
+	}
+
+	var out []PeerCandidate
+	bodies, stale := fetchURLs(ctx, urls)
+	if len(bodies) == 0 {
+		return nil, time.Time{}, fmt.Errorf("could not download any peer list from %s/%s", s.Owner, s.Repo)
+	}
+	for _, url := range urls {
+		p := pathOf[url]
+		body := decodeContents(bodies[url])
+		out = append(out, recordCandidates(parsePeerMarkdown(strings.Split(p, "/")[0], p, string(body)))...)
+	}
+	return out, olderData(treeStale, stale), nil
+}
+
+// DirSource reads a local checkout of a public-peers style repository.
+type DirSource struct {
+	Path string
+}
+
+func (s *DirSource) Spec() string { return "dir:" + s.Path }
+
+func (s *DirSource) Load(ctx context.Context) ([]PeerCandidate, time.Time, error) {
+	var out []PeerCandidate
+	err := filepath.WalkDir(s.Path, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !isPeerListFile(path) {
+			return nil
+		}
+		rel, err := filepath.Rel(s.Path, path)
+		if err != nil {
+			return err
+		}
+		parts := strings.Split(filepath.ToSlash(rel), "/")
+		if len(parts) < 2 {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		out = append(out, recordCandidates(parsePeerMarkdown(parts[0], rel, string(data)))...)
+		return nil
+	})
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	if len(out) == 0 {
+		return nil, time.Time{}, fmt.Errorf("no peers found under %s", s.Path)
+	}
+	return out, time.Time{}, nil
+}
+
+// ListSource reads peers from a URL (or local file) holding either plain
+// text with one URI per line, or JSON. In JSON, top-level object keys are
+// taken as regions and every string or key that is a peer URI is a peer.
+type ListSource struct {
+	URL string
+}
+
+func (s *ListSource) Spec() string { return "list:" + s.URL }
+
+func (s *ListSource) Load(ctx context.Context) ([]PeerCandidate, time.Time, error) {
+	var body []byte
+	var stale time.Time
+	var err error
+	if strings.HasPrefix(s.URL, "http://") || strings.HasPrefix(s.URL, "https://") {
+		body, stale, err = httpGet(ctx, s.URL)
+	} else {
+		body, err = os.ReadFile(s.URL)
+	}
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	var out []PeerCandidate
+	var doc interface{}
+	if json.Unmarshal(body, &doc) == nil {
+		if obj, ok := doc.(map[string]interface{}); ok {
+			for region, v := range obj {
+				for _, uri := range collectJSONPeers(v) {
+					out = append(out, PeerCandidate{URI: uri, Region: region})
+				}
+			}
+		} else {
+			for _, uri := range collectJSONPeers(doc) {
+				out = append(out, PeerCandidate{URI: uri})
+			}
+		}
+	} else {
+		for _, uri := range findPeerURIs(string(body)) {
+			out = append(out, PeerCandidate{URI: uri})
+		}
+	}
+	if len(out) == 0 {
+		return nil, time.Time{}, fmt.Errorf("no peers found in %s", s.URL)
+	}
+	return out, stale, nil
+}
+
+// collectJSONPeers walks a decoded JSON value for peer URIs, in both string
+// values and object keys.
+func collectJSONPeers(v interface{}) []string {
+	var out []string
+	switch v := v.(type) {
+	case string:
+		if _, err := parsePeerURI(v); err == nil {
+			out = append(out, v)
+		}
+	case []interface{}:
+		for _, item := range v {
+			out = append(out, collectJSONPeers(item)...)
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if _, err := parsePeerURI(k); err == nil {
+				out = append(out, k)
+				continue
+			}
+			out = append(out, collectJSONPeers(v[k])...)
+		}
+	}
+	return out
+}
+
+// GitMirrorSource keeps a shallow clone of a public-peers mirror in the
+// user cache directory and reads it like a DirSource.
+type GitMirrorSource struct {
+	URL, Branch string
+}
+
+func (s *GitMirrorSource) Spec() string {
+	if s.Branch == "" {
+		return "git:" + s.URL
+	}
+	return "git:" + s.URL + "@" + s.Branch
+}
+
+func (s *GitMirrorSource) checkoutDir() (string, error) {
+	sum := sha256.Sum256([]byte(s.Spec()))
+	dir, err := stateDir()
+	return filepath.Join(dir, "git", hex.EncodeToString(sum[:8])), err
+}
+
+// checkoutTime returns when the checkout was last updated from the mirror.
+func checkoutTime(dir string) time.Time {
+	for _, name := range []string{"FETCH_HEAD", "HEAD"} {
+		if info, err := os.Stat(filepath.Join(dir, ".git", name)); err == nil {
+			return info.ModTime()
+		}
+	}
+	return time.Time{}
+}
+
+func (s *GitMirrorSource) Load(ctx context.Context) ([]PeerCandidate, time.Time, error) {
+	if _, err := exec.LookPath("git"); err != nil {
+		return nil, time.Time{}, fmt.Errorf("git is not installed")
+	}
+	dir, err := s.checkoutDir()
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	if offlineMode {
+		if !fileExists(filepath.Join(dir, ".git")) {
+			return nil, time.Time{}, fmt.Errorf("%s: not cloned yet (offline mode)", s.URL)
+		}
+		return s.loadCheckout(ctx, dir, checkoutTime(dir))
+	}
+	var cmd *exec.Cmd
+	if fileExists(filepath.Join(dir, ".git")) {
+		cmd = exec.CommandContext(ctx, "git", "-C", dir, "pull", "--ff-only", "--depth", "1")
+	} else {
+		if err := os.MkdirAll(filepath.Dir(dir), 0755); err != nil {
+			return nil, time.Time{}, err
+		}
+		args := []string{"clone", "--depth", "1"}
+		if s.Branch != "" {
+			args = append(args, "--branch", s.Branch)
+		}
+		cmd = exec.CommandContext(ctx, "git", append(args, s.URL, dir)...)
+	}
+	var stale time.Time
+	if out, err := cmd.CombinedOutput(); err != nil {
+		if !fileExists(filepath.Join(dir, ".git")) {
+			return nil, time.Time{}, fmt.Errorf("git: %v: %s", err, strings.TrimSpace(string(out)))
+		}
+		// Offline or the mirror is down: the last checkout is still useful
+		stale = checkoutTime(dir)
+	}
+	return s.loadCheckout(ctx, dir, stale)
+}
+
+// loadCheckout reads the checkout; stale is passed through as the source's.
+func (s *GitMirrorSource) loadCheckout(ctx context.Context, dir string, stale time.Time) ([]PeerCandidate, time.Time, error) {
+	out, _, err := (&DirSource{Path: dir}).Load(ctx)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	return out, stale, nil
+}
+
+func printPeerSources(settings *Settings) {
+	fmt.Printf("Peers repository: %s", peerRepo.Spec())
+	if !peerRepo.isDefaultAPI() {
+		fmt.Printf(" via %s", peerRepo.APIBase)
+	}
+	fmt.Println()
+	specs := settings.Sources
+	if len(specs) == 0 {
+		fmt.Println(yellow("No sources saved, using the default:"))
+		specs = defaultPeerSources()
+	}
+	for i, spec := range specs {
+		fmt.Printf("%d. %s\n", i+1, spec)
+	}
+}
+
+// addPeerSource saves a source. The first one saved would replace the
+// default, so the default is saved along with it, and the user is told.
+func addPeerSource(settings *Settings, src PeerSource) {
+	if len(settings.Sources) == 0 {
+		settings.Sources = append(settings.Sources, defaultPeerSources()...)
+		fmt.Println(yellow("The default source " + strings.Join(defaultPeerSources(), ", ") + " is kept as well; remove it to use only your own sources."))
+	}
+	settings.Sources = append(settings.Sources, src.Spec())
+}
+
+// removePeerSource drops the saved sources with the same Spec as src, so
+// "github:owner/repo" removes the "github:owner/repo@master" that add saved.
+func removePeerSource(settings *Settings, src PeerSource) bool {
+	var keep []string
+	for _, spec := range settings.Sources {
+		saved, err := parsePeerSource(spec)
+		if spec == src.Spec() || err == nil && saved.Spec() == src.Spec() {
+			continue
+		}
+		keep = append(keep, spec)
+	}
+	removed := len(keep) < len(settings.Sources)
+	settings.Sources = keep
+	return removed
+}
+
+func peerSourcesMenu() {
+	for {
+		clearScreen()
+		fmt.Println(cyan("=== Peer Sources ===\n"))
+		settings, err := loadSettings()
+		if err != nil {
+			fmt.Println(red("Error: "), err)
+			waitEnter()
+			return
+		}
+		printPeerSources(settings)
+		if len(sourceFlags) > 0 {
+			fmt.Println(yellow("\n--source was given: these saved sources are not used in this session."))
+		}
+		if updated := peerCacheUpdated(); updated.IsZero() {
+			fmt.Println("\nPeer cache: empty")
+		} else {
+			dir, _ := httpCacheDir()
+			fmt.Printf("\nPeer cache: updated %s (%s)\n", formatAge(updated), dir)
+		}
+		fmt.Println()
+
+		action := ""
+		err = survey.AskOne(&survey.Select{
+			Message: "Sources Menu (Esc to back):",
+			Options: []string{"Add Source", "Remove Sources", "Test Sources", "Clear Cache", "Back"},
+		}, &action)
+		if err == terminal.InterruptErr || action == "Back" || action == "" {
+			return
+		}
+
+		switch action {
+		case "Add Source":
+			spec := ""
+			err := survey.AskOne(&survey.Input{
+				Message: "Source:",
+				Help:    "github:owner/repo[@branch], dir:/path/to/public-peers, list:https://example.org/peers.txt, git:https://example.org/public-peers.git or status:https://example.org/status.json",
+			}, &spec, survey.WithValidator(func(ans interface{}) error {
+				_, err := parsePeerSource(ans.(string))
+				return err
+			}))
+			if err != nil {
+				continue
+			}
+			src, _ := parsePeerSource(spec)
+			addPeerSource(settings, src)
+		case "Remove Sources":
+			if len(settings.Sources) == 0 {
+				continue
+			}
+			var picked []string
+			if err := survey.AskOne(&survey.MultiSelect{Message: "Select to Remove:", Options: settings.Sources}, &picked); err != nil || len(picked) == 0 {
+				continue
+			}
+			var keep []string
+			for _, s := range settings.Sources {
+				remove := false
+				for _, p := range picked {
+					if s == p {
+						remove = true
+						break
+					}
+				}
+				if !remove {
+					keep = append(keep, s)
+				}
+			}
+			settings.Sources = keep
+		case "Clear Cache":
+			if err := clearPeerCache(); err != nil {
+				fmt.Println(red("Error: "), err)
+			} else {
+				fmt.Println(green("Peer cache cleared."))
+			}
+			waitEnter()
+			continue
+		case "Test Sources":
+			sources, err := configuredPeerSources()
+			if err == nil {
+				var candidates []PeerCandidate
+				ctx, cancel := interruptible(fetchTimeout)
+				candidates, err = loadPeerCandidates(ctx, sources)
+				cancel()
+				fmt.Printf("\nTotal: %d unique peers.\n", len(candidates))
+			}
+			if err != nil {
+				fmt.Println(red("Error: "), err)
+			}
+			waitEnter()
+			continue
+		}
+
+		if err := settings.Save(); err != nil {
+			fmt.Println(red("Failed to save settings: "), err)
+		} else {
+			path, _ := settingsPath()
+			fmt.Println(green("Sources saved to " + path))
+		}
+		waitEnter()
+	}
+}
+
+// sourcesCommand handles "ygglazy sources ...".
+func sourcesCommand(args []string) error {
+	if len(args) == 0 {
+		args = []string{"list"}
+	}
+	settings, err := loadSettings()
+	if err != nil {
+		return err
+	}
+	switch args[0] {
+	case "list":
+		printPeerSources(settings)
+		return nil
+	case "add":
+		if len(args) < 2 {
+			return fmt.Errorf("usage: ygglazy sources add <spec>")
+		}
+		src, err := parsePeerSource(args[1])
+		if err != nil {
+			return err
+		}
+		addPeerSource(settings, src)
+	case "remove":
+		if len(args) < 2 {
+			return fmt.Errorf("usage: ygglazy sources remove <spec>")
+		}
+		src, err := parsePeerSource(args[1])
+		if err != nil {
+			return err
+		}
+		if !removePeerSource(settings, src) {
+			return fmt.Errorf("%s is not a saved source", src.Spec())
+		}
+	default:
+		return fmt.Errorf("unknown sources command: %s", args[0])
+	}
+	if err := settings.Save(); err != nil {
+		return err
+	}
+	printPeerSources(settings)
+	return nil
+}
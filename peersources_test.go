@@ -0,0 +1,144 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// staticSource is a PeerSource serving fixed candidates.
+type staticSource struct {
+	spec  string
+	peers []PeerCandidate
+}
+
+func (s *staticSource) Spec() string { return s.spec }
+func (s *staticSource) Load(ctx context.Context) ([]PeerCandidate, time.Time, error) {
+	return s.peers, time.Time{}, nil
+}
+
+func TestLoadPeerCandidatesMerge(t *testing.T) {
+	feed := &FeedStatus{Up: true, Uptime: 0.9}
+	sources := []PeerSource{
+		&staticSource{"list:a", []PeerCandidate{{URI: "tls://a.example:443"}, {URI: "tls://b.example:443", Region: "asia", Country: "Japan"}}},
+		&staticSource{"dir:b", []PeerCandidate{
+			{URI: "TLS://A.example:443?key=", Region: "europe", Country: "Germany", Operator: "Alice"},
+			{URI: "tls://b.example:443", Region: "europe", Country: "France"},
+		}},
+		&staticSource{"status:c", []PeerCandidate{{URI: "tls://a.example:443", Feed: feed}}},
+	}
+	got, err := loadPeerCandidates(context.Background(), sources)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []PeerCandidate{
+		{URI: "tls://a.example:443", Region: "europe", Country: "Germany", Operator: "Alice", Source: "list:a", Feed: feed},
+		{URI: "tls://b.example:443", Region: "asia", Country: "Japan", Source: "list:a"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("loadPeerCandidates() = %+v, want %+v", got, want)
+	}
+}
+
+func tarball(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, body := range files {
+		tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(body)), Typeflag: tar.TypeReg})
+		tw.Write([]byte(body))
+	}
+	tw.Close()
+	gz.Close()
+	return buf.Bytes()
+}
+
+func TestGitHubSourceTruncatedTree(t *testing.T) {
+	isolateDirs(t)
+	archive := tarball(t, map[string]string{
+		"o-r-1234/europe/germany.md": "* `tls://a.example:443`\n",
+		"o-r-1234/asia/japan.md":     "* `tcp://b.example:80`\n",
+	})
+	var mu sync.Mutex
+	var fetched []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		fetched = append(fetched, r.URL.Path)
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/repos/o/r/git/trees/master":
+			w.Write([]byte(`{"tree": [{"path": "europe/germany.md", "type": "blob"}], "truncated": true}`))
+		case "/repos/o/r/tarball/master":
+			w.Write(archive)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	saved := peerRepo
+	peerRepo.APIBase = srv.URL
+	defer func() { peerRepo = saved }()
+
+	src := &GitHubSource{Owner: "o", Repo: "r", Branch: "master"}
+	got, _, err := src.Load(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found []string
+	for _, c := range got {
+		found = append(found, c.Region+" "+c.URI)
+	}
+	sort.Strings(found)
+	if want := []string{"asia tcp://b.example:80", "europe tls://a.example:443"}; !reflect.DeepEqual(found, want) {
+		t.Errorf("Load() = %v, want %v", found, want)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if want := []string{"/repos/o/r/git/trees/master", "/repos/o/r/tarball/master"}; !reflect.DeepEqual(fetched, want) {
+		t.Errorf("fetched %v, want the tree and then the archive", fetched)
+	}
+}
+
+func TestAddPeerSource(t *testing.T) {
+	settings := &Settings{}
+	addPeerSource(settings, &ListSource{URL: "https://example.org/peers.txt"})
+	addPeerSource(settings, &DirSource{Path: "/srv/peers"})
+	want := append(defaultPeerSources(), "list:https://example.org/peers.txt", "dir:/srv/peers")
+	if !reflect.DeepEqual(settings.Sources, want) {
+		t.Errorf("Sources = %v, want %v", settings.Sources, want)
+	}
+}
+
+func TestRemovePeerSource(t *testing.T) {
+	settings := &Settings{Sources: []string{
+		"github:yggdrasil-network/public-peers@master",
+		"list:https://example.org/peers.txt",
+		"git:https://example.org/peers.git@main",
+	}}
+	for _, spec := range []string{"github:yggdrasil-network/public-peers", "https://example.org/peers.txt"} {
+		src, err := parsePeerSource(spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !removePeerSource(settings, src) {
+			t.Errorf("%s did not match a saved source", spec)
+		}
+	}
+	src, _ := parsePeerSource("git:https://example.org/peers.git")
+	if removePeerSource(settings, src) {
+		t.Error("a git source without a branch removed the one on main")
+	}
+	want := []string{"git:https://example.org/peers.git@main"}
+	if !reflect.DeepEqual(settings.Sources, want) {
+		t.Errorf("Sources = %v, want %v", settings.Sources, want)
+	}
+}
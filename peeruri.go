@@ -0,0 +1,307 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// --- Peer URIs ---
+
+// peerSchemes lists every link type Yggdrasil can peer over.
+var peerSchemes = []string{"tcp", "tls", "quic", "ws", "wss", "socks", "sockstls", "unix"}
+
+// peerURIRe finds peer URIs in free text such as the public-peers markdown.
+// It keeps the query string, so options like ?key= are not lost.
+var peerURIRe = regexp.MustCompile("(?:tcp|tls|quic|wss|ws|sockstls|socks|unix)://[^\\s`<>\"'|()]+")
+
+// PeerParam is one query option of a peer URI, kept raw (still escaped).
+type PeerParam struct {
+	Key   string
+	Value string
+}
+
+// PeerURI is a parsed peer connection string. It keeps the query options in
+// their original order, so String() gives back what was parsed.
+type PeerURI struct {
+	Scheme string
+	User   string // Raw userinfo for socks proxies
+	Host   string // Hostname or IP, without IPv6 brackets; empty for "every address" listeners
+	Port   string
+	Path   string // Target "host:port" for socks, socket path for unix
+	Params []PeerParam
+
+	dialIP string // Resolved address to dial instead of Host, see withIP
+}
+
+// parsePeerURI checks a URI to dial, such as "tls://host:443?key=...".
+func parsePeerURI(s string) (*PeerURI, error) {
+	return parseURI(s, false)
+}
+
+// parseURI parses a peer or, with listen set, a Listen entry. Only listeners
+// may leave the host empty ("tcp://:1234"), which binds every address.
+func parseURI(s string, listen bool) (*PeerURI, error) {
+	s = strings.TrimSpace(s)
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid peer URI %q: %v", s, err)
+	}
+
+	p := &PeerURI{Scheme: strings.ToLower(u.Scheme)}
+	known := false
+	for _, scheme := range peerSchemes {
+		if p.Scheme == scheme {
+			known = true
+			break
+		}
+	}
+	if !known {
+		return nil, fmt.Errorf("invalid peer URI %q: unsupported scheme %q", s, u.Scheme)
+	}
+	if u.User != nil {
+		p.User = u.User.String()
+	}
+	if u.RawQuery != "" {
+		for _, kv := range strings.Split(u.RawQuery, "&") {
+			if kv == "" {
+				continue
+			}
+			k, v, _ := strings.Cut(kv, "=")
+			p.Params = append(p.Params, PeerParam{Key: k, Value: v})
+		}
+	}
+
+	if p.Scheme == "unix" {
+		p.Path = u.Path
+		if p.Path == "" {
+			return nil, fmt.Errorf("invalid peer URI %q: missing socket path", s)
+		}
+		return p, p.validateParams(s)
+	}
+
+	p.Host = u.Hostname()
+	p.Port = u.Port()
+	if p.Host == "" && !listen {
+		return nil, fmt.Errorf("invalid peer URI %q: missing host", s)
+	}
+	if n, err := strconv.Atoi(p.Port); err != nil || n < 1 || n > 65535 {
+		return nil, fmt.Errorf("invalid peer URI %q: missing or invalid port", s)
+	}
+	p.Path = strings.TrimPrefix(u.Path, "/")
+	if p.Scheme == "socks" || p.Scheme == "sockstls" {
+		if _, _, err := net.SplitHostPort(p.Path); err != nil {
+			return nil, fmt.Errorf("invalid peer URI %q: socks peers need a target host:port after the proxy", s)
+		}
+	}
+	return p, p.validateParams(s)
+}
+
+func (p *PeerURI) validateParams(s string) error {
+	if key := p.PublicKey(); key != "" {
+		if b, err := hex.DecodeString(key); err != nil || len(b) != 32 {
+			return fmt.Errorf("invalid peer URI %q: key must be 64 hex characters", s)
+		}
+	}
+	if v, ok := p.Param("priority"); ok {
+		if n, err := strconv.Atoi(v); err != nil || n < 0 || n > 255 {
+			return fmt.Errorf("invalid peer URI %q: priority must be 0-255", s)
+		}
+	}
+	if v, ok := p.Param("maxbackoff"); ok {
+		if _, err := time.ParseDuration(v); err != nil {
+			return fmt.Errorf("invalid peer URI %q: maxbackoff must be a duration like 30s", s)
+		}
+	}
+	return nil
+}
+
+// String rebuilds the URI with all of its options.
+func (p *PeerURI) String() string {
+	var b strings.Builder
+	b.WriteString(p.Scheme)
+	b.WriteString("://")
+	if p.Scheme == "unix" {
+		b.WriteString(p.Path)
+	} else {
+		if p.User != "" {
+			b.WriteString(p.User)
+			b.WriteString("@")
+		}
+		// Zones of link-local addresses must stay escaped inside the URI
+		b.WriteString(net.JoinHostPort(strings.ReplaceAll(p.Host, "%", "%25"), p.Port))
+		if p.Path != "" {
+			b.WriteString("/")
+			b.WriteString(p.Path)
+		}
+	}
+	for i, param := range p.Params {
+		if i == 0 {
+			b.WriteString("?")
+		} else {
+			b.WriteString("&")
+		}
+		b.WriteString(param.Key)
+		if param.Value != "" {
+			b.WriteString("=")
+			b.WriteString(param.Value)
+		}
+	}
+	return b.String()
+}
+
+// Endpoint identifies the remote end without options, e.g. "tls://1.2.3.4:443".
+// Two URIs with the same endpoint connect to the same place.
+func (p *PeerURI) Endpoint() string {
+	if p.Scheme == "unix" {
+		return p.Scheme + "://" + p.Path
+	}
+	e := p.Scheme + "://" + net.JoinHostPort(p.Host, p.Port)
+	if p.Path != "" {
+		e += "/" + p.Path
+	}
+	return strings.ToLower(e)
+}
+
+// Network returns the transport to dial for this URI.
+func (p *PeerURI) Network() string {
+	switch p.Scheme {
+	case "quic":
+		return "udp"
+	case "unix":
+		return "unix"
+	}
+	return "tcp"
+}
+
+// Address returns what to dial: host:port (the proxy for socks), or the
+// socket path for unix.
+func (p *PeerURI) Address() string {
+	if p.Scheme == "unix" {
+		return p.Path
+	}
+	if p.dialIP != "" {
+		return net.JoinHostPort(p.dialIP, p.Port)
+	}
+	return net.JoinHostPort(p.Host, p.Port)
+}
+
+// withIP returns a copy that dials ip. Host, and so SNI and the WebSocket
+// Host header, stay as they were.
+func (p *PeerURI) withIP(ip net.IP) *PeerURI {
+	c := *p
+	c.dialIP = ip.String()
+	return &c
+}
+
+// Param returns the unescaped value of a query option.
+func (p *PeerURI) Param(key string) (string, bool) {
+	for _, param := range p.Params {
+		if strings.EqualFold(param.Key, key) {
+			v, err := url.QueryUnescape(param.Value)
+			if err != nil {
+				v = param.Value
+			}
+			return v, true
+		}
+	}
+	return "", false
+}
+
+// SetParam sets a query option, replacing it in place if present.
+func (p *PeerURI) SetParam(key, value string) {
+	escaped := url.QueryEscape(value)
+	for i, param := range p.Params {
+		if strings.EqualFold(param.Key, key) {
+			p.Params[i].Value = escaped
+			return
+		}
+	}
+	p.Params = append(p.Params, PeerParam{Key: key, Value: escaped})
+}
+
+// RemoveParam deletes a query option.
+func (p *PeerURI) RemoveParam(key string) {
+	for i, param := range p.Params {
+		if strings.EqualFold(param.Key, key) {
+			p.Params = append(p.Params[:i], p.Params[i+1:]...)
+			return
+		}
+	}
+}
+
+// PublicKey returns the pinned remote key (?key=), lower-cased.
+func (p *PeerURI) PublicKey() string {
+	v, _ := p.Param("key")
+	return strings.ToLower(v)
+}
+
+// SNI returns the TLS server name (?sni=), defaulting to the host name.
+func (p *PeerURI) SNI() string {
+	if v, ok := p.Param("sni"); ok {
+		return v
+	}
+	if net.ParseIP(p.Host) != nil {
+		return ""
+	}
+	return p.Host
+}
+
+// Password returns the link password (?password=).
+func (p *PeerURI) Password() string {
+	v, _ := p.Param("password")
+	return v
+}
+
+// Priority returns the link priority (?priority=).
+func (p *PeerURI) Priority() (int, bool) {
+	v, ok := p.Param("priority")
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.Atoi(v)
+	return n, err == nil
+}
+
+// MaxBackoff returns the reconnect backoff limit (?maxbackoff=).
+func (p *PeerURI) MaxBackoff() (time.Duration, bool) {
+	v, ok := p.Param("maxbackoff")
+	if !ok {
+		return 0, false
+	}
+	d, err := time.ParseDuration(v)
+	return d, err == nil
+}
+
+// samePeer reports whether two URI strings point at the same endpoint.
+func samePeer(a, b string) bool {
+	if a == b {
+		return true
+	}
+	pa, err := parsePeerURI(a)
+	if err != nil {
+		return false
+	}
+	pb, err := parsePeerURI(b)
+	if err != nil {
+		return false
+	}
+	return pa.Endpoint() == pb.Endpoint()
+}
+
+// findPeerURIs extracts every valid peer URI from free text.
+func findPeerURIs(text string) []string {
+	var out []string
+	for _, m := range peerURIRe.FindAllString(text, -1) {
+		m = strings.TrimRight(m, ".,;")
+		if p, err := parsePeerURI(m); err == nil {
+			out = append(out, p.String())
+		}
+	}
+	return out
+}
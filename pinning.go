@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/AlecAivazis/survey/v2"
+)
+
+// --- Key Pinning ---
+
+// A peer URI with ?key= only peers with the node holding that key, so a
+// hijacked DNS name or a man in the middle can't take the peering over.
+
+// pinKey returns uri with its ?key= set to key.
+func pinKey(uri, key string) (string, error) {
+	key, err := normalizePublicKey(key)
+	if err != nil {
+		return "", err
+	}
+	p, err := parsePeerURI(uri)
+	if err != nil {
+		return "", err
+	}
+	p.SetParam("key", key)
+	return p.String(), nil
+}
+
+// KeyMismatch is a configured peer whose pinned key differs from the key
+// the node at that address presents now.
+type KeyMismatch struct {
+	Peer    ConfiguredPeer
+	Pinned  string
+	Current string
+}
+
+// liveKey returns the key of the node at uri: the one the running service
+// reports for an up connection, else the one from a handshake.
+func liveKey(ctx context.Context, uri string, live []PeerStatus) (string, error) {
+	for _, s := range live {
+		if s.Up && s.Key != "" && samePeer(s.URI, uri) {
+			return s.Key, nil
+		}
+	}
+	p, err := parsePeerURI(uri)
+	if err != nil {
+		return "", err
+	}
+	// Only a key with a valid signature is worth pinning or comparing
+	meta, err := verifyYggdrasil(ctx, p, probeConfig.Timeout)
+	if err != nil {
+		return "", err
+	}
+	return meta.KeyHex(), nil
+}
+
+// liveKeys looks up the current key of each peer concurrently. Peers whose
+// key can't be learned are left out.
+func liveKeys(ctx context.Context, peers []ConfiguredPeer, live []PeerStatus) map[ConfiguredPeer]string {
+	keys := make(map[ConfiguredPeer]string)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, 10)
+	for _, cp := range peers {
+		wg.Add(1)
+		go func(cp ConfiguredPeer) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			if key, err := liveKey(ctx, cp.URI, live); err == nil {
+				mu.Lock()
+				keys[cp] = key
+				mu.Unlock()
+			}
+		}(cp)
+	}
+	wg.Wait()
+	return keys
+}
+
+// findKeyMismatches checks every configured peer with a pinned key.
+func findKeyMismatches(ctx context.Context, peers []ConfiguredPeer, live []PeerStatus) []KeyMismatch {
+	var pinned []ConfiguredPeer
+	for _, cp := range peers {
+		if p, err := parsePeerURI(cp.URI); err == nil && p.PublicKey() != "" {
+			pinned = append(pinned, cp)
+		}
+	}
+	return keyMismatches(pinned, liveKeys(ctx, pinned, live))
+}
+
+// keyMismatches compares the pinned keys of peers with the learned ones.
+// Peers without a pin or a learned key are skipped.
+func keyMismatches(peers []ConfiguredPeer, keys map[ConfiguredPeer]string) []KeyMismatch {
+	var out []KeyMismatch
+	for _, cp := range peers {
+		p, err := parsePeerURI(cp.URI)
+		if err != nil || p.PublicKey() == "" {
+			continue
+		}
+		if key, ok := keys[cp]; ok && key != p.PublicKey() {
+			out = append(out, KeyMismatch{Peer: cp, Pinned: p.PublicKey(), Current: key})
+		}
+	}
+	return out
+}
+
+// printKeyMismatches flags pinned peers whose node changed its key. Such
+// peers can't connect until the pin is updated or the peer is removed.
+func printKeyMismatches(peers []ConfiguredPeer, live []PeerStatus) {
+	ctx, cancel := interruptible(probeConfig.ScanDeadline)
+	defer cancel()
+	reportKeyMismatches(findKeyMismatches(ctx, peers, live))
+}
+
+func reportKeyMismatches(mismatches []KeyMismatch) {
+	if len(mismatches) == 0 {
+		return
+	}
+	fmt.Println(red("⚠ Pinned key mismatch (possible hijack, or the node changed its key):"))
+	for _, m := range mismatches {
+		fmt.Printf("  %s\n    pinned: %s\n    live:   %s\n", m.Peer.Label(), shortKey(m.Pinned), shortKey(m.Current))
+	}
+	fmt.Println(yellow("Re-pin with 'Pin Peer Keys' only if you trust the new key."))
+	fmt.Println()
+}
+
+// setConfiguredURIs replaces configured peer URIs in place, keeping their
+// position in the list they live in.
+func setConfiguredURIs(replace map[ConfiguredPeer]string) error {
+	cfg, err := loadConfig(detectedConfigPath)
+	if err != nil {
+		return err
+	}
+	byList := make(map[string]bool)
+	for cp := range replace {
+		byList[cp.Interface] = true
+	}
+	for iface := range byList {
+		list := cfg.PeerList(iface)
+		for i, uri := range list {
+			if newURI, ok := replace[ConfiguredPeer{URI: uri, Interface: iface}]; ok {
+				list[i] = newURI
+			}
+		}
+		cfg.SetPeerList(iface, list)
+	}
+	return cfg.Save()
+}
+
+// pinPeerKeysMenu learns the keys of configured peers without a pin and
+// offers to write them into the config. Peers with a pin are checked too.
+func pinPeerKeysMenu() {
+	clearScreen()
+	fmt.Println(cyan("=== Pin Peer Keys ===\n"))
+
+	peers := getAllConfigPeers()
+	if len(peers) == 0 {
+		fmt.Println(yellow("No peers in config."))
+		waitEnter()
+		return
+	}
+	live, err := getLivePeers()
+	if err != nil {
+		fmt.Println(yellow("Service peer data unavailable, learning keys by handshake only."))
+	}
+
+	var unpinned []ConfiguredPeer
+	for _, cp := range peers {
+		if p, err := parsePeerURI(cp.URI); err == nil && p.PublicKey() == "" {
+			unpinned = append(unpinned, cp)
+		}
+	}
+	// One pass learns every key, so checking the pins doesn't eat into the
+	// deadline for learning the rest
+	fmt.Printf("Checking %d peers...\n\n", len(peers))
+	ctx, cancel := interruptible(probeConfig.ScanDeadline)
+	keys := liveKeys(ctx, peers, live)
+	cancel()
+	mismatches := keyMismatches(peers, keys)
+	reportKeyMismatches(mismatches)
+
+	if len(unpinned) == 0 && len(mismatches) == 0 {
+		fmt.Println(green("✓ Every configured peer has a pinned key."))
+		waitEnter()
+		return
+	}
+	var options, defaults []string
+	var candidates []ConfiguredPeer
+	for _, cp := range unpinned {
+		if key, ok := keys[cp]; ok {
+			option := fmt.Sprintf("%s → %s", cp.Label(), shortKey(key))
+			options = append(options, option)
+			defaults = append(defaults, option)
+			candidates = append(candidates, cp)
+		}
+	}
+	if missing := len(unpinned) - len(candidates); missing > 0 {
+		fmt.Println(yellow(fmt.Sprintf("%d unpinned peers didn't answer a handshake; their keys are unknown.", missing)))
+	}
+	// Re-pinning a changed key is offered but never preselected
+	for _, m := range mismatches {
+		keys[m.Peer] = m.Current
+		options = append(options, fmt.Sprintf("%s → %s (replaces pinned key)", m.Peer.Label(), shortKey(m.Current)))
+		candidates = append(candidates, m.Peer)
+	}
+	if len(candidates) == 0 {
+		waitEnter()
+		return
+	}
+
+	var picked []int
+	err = survey.AskOne(&survey.MultiSelect{
+		Message:  "Pin keys for:",
+		Options:  options,
+		Default:  defaults,
+		PageSize: 15,
+	}, &picked)
+	if err != nil || len(picked) == 0 {
+		return
+	}
+	replace := make(map[ConfiguredPeer]string)
+	for _, i := range picked {
+		cp := candidates[i]
+		pinned, err := pinKey(cp.URI, keys[cp])
+		if err != nil {
+			fmt.Println(red("Error: "), err)
+			waitEnter()
+			return
+		}
+		replace[cp] = pinned
+	}
+	if err := setConfiguredURIs(replace); err != nil {
+		fmt.Println(red("Failed to update config: "), err)
+		waitEnter()
+		return
+	}
+	fmt.Println(green(fmt.Sprintf("Pinned %d peer keys.", len(replace))))
+	restartServicePrompt()
+}
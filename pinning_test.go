@@ -0,0 +1,22 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestKeyMismatches(t *testing.T) {
+	a, b := strings.Repeat("a", 64), strings.Repeat("b", 64)
+	same := ConfiguredPeer{URI: "tls://same.example:443?key=" + a}
+	changed := ConfiguredPeer{URI: "tls://changed.example:443?key=" + a, Interface: "eth0"}
+	silent := ConfiguredPeer{URI: "tls://silent.example:443?key=" + a}
+	unpinned := ConfiguredPeer{URI: "tls://unpinned.example:443"}
+	keys := map[ConfiguredPeer]string{same: a, changed: b, unpinned: b}
+
+	got := keyMismatches([]ConfiguredPeer{same, changed, silent, unpinned}, keys)
+	want := []KeyMismatch{{Peer: changed, Pinned: a, Current: b}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("keyMismatches() = %+v, want %+v", got, want)
+	}
+}
@@ -14,6 +14,9 @@ type Platform interface {
 	// ManageService starts/stops/restarts/enables/disables the service
 	ManageService(action string) error
 	
+	// ServiceRunning reports whether the service manager has the service up
+	ServiceRunning() bool
+	
 	// GetServiceCommands returns platform-specific service commands
 	GetServiceCommands() []string
 }
@@ -8,6 +8,7 @@ import (
 	"os"
 	"os/exec"
 	"runtime"
+	"strings"
 
 	"github.com/AlecAivazis/survey/v2"
 )
@@ -127,6 +128,12 @@ func (p *DarwinPlatform) ManageService(act string) error {
 	}
 }
 
+func (p *DarwinPlatform) ServiceRunning() bool {
+	// launchctl list prints a PID only while the daemon is running
+	out, err := exec.Command("launchctl", "list", "com.github.yggdrasil-network.yggdrasil").Output()
+	return err == nil && strings.Contains(string(out), "\"PID\"")
+}
+
 func (p *DarwinPlatform) GetServiceCommands() []string {
 	return []string{"Start", "Stop", "Restart", "Enable Autostart", "Disable Autostart"}
 }
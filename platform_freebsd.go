@@ -105,6 +105,10 @@ func (p *FreeBSDPlatform) ManageService(act string) error {
 	}
 }
 
+func (p *FreeBSDPlatform) ServiceRunning() bool {
+	return exec.Command("service", "yggdrasil", "status").Run() == nil
+}
+
 func (p *FreeBSDPlatform) GetServiceCommands() []string {
 	return []string{"Start", "Stop", "Restart", "Enable Autostart", "Disable Autostart"}
 }
@@ -158,6 +158,10 @@ func (p *LinuxPlatform) ManageService(act string) error {
 	return exec.Command("systemctl", verb, "yggdrasil").Run()
 }
 
+func (p *LinuxPlatform) ServiceRunning() bool {
+	return exec.Command("systemctl", "is-active", "--quiet", "yggdrasil").Run() == nil
+}
+
 func (p *LinuxPlatform) GetServiceCommands() []string {
 	return []string{"start", "stop", "restart", "Enable Autostart", "Disable Autostart"}
 }
@@ -103,6 +103,10 @@ func (p *NetBSDPlatform) ManageService(act string) error {
 	}
 }
 
+func (p *NetBSDPlatform) ServiceRunning() bool {
+	return exec.Command("/etc/rc.d/yggdrasil", "status").Run() == nil
+}
+
 func (p *NetBSDPlatform) GetServiceCommands() []string {
 	return []string{"Start", "Stop", "Restart", "Enable Autostart", "Disable Autostart"}
 }
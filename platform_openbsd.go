@@ -70,6 +70,10 @@ func (p *OpenBSDPlatform) ManageService(act string) error {
 	}
 }
 
+func (p *OpenBSDPlatform) ServiceRunning() bool {
+	return exec.Command("rcctl", "check", "yggdrasil").Run() == nil
+}
+
 func (p *OpenBSDPlatform) GetServiceCommands() []string {
 	return []string{"Start", "Stop", "Restart", "Enable Autostart", "Disable Autostart"}
 }
@@ -91,6 +91,11 @@ func (p *WindowsPlatform) ManageService(act string) error {
 	return exec.Command("powershell", "-Command", cmd).Run()
 }
 
+func (p *WindowsPlatform) ServiceRunning() bool {
+	out, err := exec.Command("powershell", "-Command", "(Get-Service yggdrasil).Status").Output()
+	return err == nil && strings.TrimSpace(string(out)) == "Running"
+}
+
 func (p *WindowsPlatform) GetServiceCommands() []string {
 	return []string{"Start", "Stop", "Restart", "Enable Autostart", "Disable Autostart"}
 }
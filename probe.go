@@ -0,0 +1,272 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+// --- Probers ---
+
+// ProbeResult times one probe. Connect is the TCP connect; Handshake is
+// whatever the link type layers on top (TLS, WebSocket upgrade, QUIC), and
+// zero for plain TCP. QUIC has no connect step, so only Handshake is set.
+type ProbeResult struct {
+	Connect   time.Duration
+	Handshake time.Duration
+}
+
+func (r ProbeResult) Total() time.Duration {
+	return r.Connect + r.Handshake
+}
+
+// Prober checks that a peer answers with the protocol its scheme promises.
+type Prober interface {
+	Probe(ctx context.Context, p *PeerURI, timeout time.Duration) (ProbeResult, error)
+}
+
+// proberFor returns the prober for a URI's scheme. Schemes without a
+// dedicated prober (socks, unix) are checked with a plain connect.
+func proberFor(scheme string) Prober {
+	switch scheme {
+	case "tls":
+		return tlsProber{}
+	case "ws":
+		return wsProber{}
+	case "wss":
+		return wsProber{TLS: true}
+	case "quic":
+		return quicProber{}
+	}
+	return tcpProber{}
+}
+
+type tcpProber struct{}
+
+func (tcpProber) Probe(ctx context.Context, p *PeerURI, timeout time.Duration) (ProbeResult, error) {
+	conn, res, err := dialTCP(ctx, p, timeout)
+	if err != nil {
+		return res, err
+	}
+	conn.Close()
+	return res, nil
+}
+
+type tlsProber struct{}
+
+func (tlsProber) Probe(ctx context.Context, p *PeerURI, timeout time.Duration) (ProbeResult, error) {
+	conn, res, err := dialTLS(ctx, p, timeout)
+	if err != nil {
+		return res, err
+	}
+	conn.Close()
+	return res, nil
+}
+
+type wsProber struct {
+	TLS bool
+}
+
+func (w wsProber) Probe(ctx context.Context, p *PeerURI, timeout time.Duration) (ProbeResult, error) {
+	conn, res, err := dialWS(ctx, p, w.TLS, timeout)
+	if err != nil {
+		return res, err
+	}
+	conn.Close()
+	return res, nil
+}
+
+// dialTCP connects within timeout. The connection's I/O is bounded by the
+// same timeout and is aborted when ctx ends.
+func dialTCP(ctx context.Context, p *PeerURI, timeout time.Duration) (net.Conn, ProbeResult, error) {
+	var res ProbeResult
+	start := time.Now()
+	d := net.Dialer{Timeout: timeout}
+	conn, err := d.DialContext(ctx, p.Network(), p.Address())
+	if err != nil {
+		return nil, res, err
+	}
+	res.Connect = time.Since(start)
+	conn.SetDeadline(start.Add(timeout))
+	return watchConn(ctx, conn), res, nil
+}
+
+// cancelConn is a connection whose pending reads and writes fail once its
+// context ends, so a cancelled scan doesn't wait out every timeout.
+type cancelConn struct {
+	net.Conn
+	stop func() bool
+}
+
+func watchConn(ctx context.Context, conn net.Conn) net.Conn {
+	stop := context.AfterFunc(ctx, func() {
+		conn.SetDeadline(time.Now())
+	})
+	return &cancelConn{Conn: conn, stop: stop}
+}
+
+func (c *cancelConn) Close() error {
+	c.stop()
+	return c.Conn.Close()
+}
+
+// dialTLS connects and completes a TLS handshake. Yggdrasil nodes use
+// self-signed certificates and authenticate with their keys instead, so
+// the certificate isn't verified.
+func dialTLS(ctx context.Context, p *PeerURI, timeout time.Duration) (net.Conn, ProbeResult, error) {
+	conn, res, err := dialTCP(ctx, p, timeout)
+	if err != nil {
+		return nil, res, err
+	}
+	start := time.Now()
+	tlsConn := tls.Client(conn, &tls.Config{
+		ServerName:         p.SNI(),
+		InsecureSkipVerify: true,
+		MinVersion:         tls.VersionTLS12,
+	})
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, res, fmt.Errorf("TLS handshake: %v", err)
+	}
+	res.Handshake = time.Since(start)
+	return tlsConn, res, nil
+}
+
+// wsGUID is the fixed key suffix of RFC 6455.
+const wsGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// bufferedConn keeps bytes read past the HTTP response.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+// dialWS connects (over TLS for wss) and upgrades to a WebSocket with the
+// "ygg-ws" subprotocol Yggdrasil uses. The handshake time covers TLS and
+// the upgrade.
+func dialWS(ctx context.Context, p *PeerURI, secure bool, timeout time.Duration) (net.Conn, ProbeResult, error) {
+	var conn net.Conn
+	var res ProbeResult
+	var err error
+	if secure {
+		conn, res, err = dialTLS(ctx, p, timeout)
+	} else {
+		conn, res, err = dialTCP(ctx, p, timeout)
+	}
+	if err != nil {
+		return nil, res, err
+	}
+	start := time.Now()
+
+	nonce := make([]byte, 16)
+	rand.Read(nonce)
+	key := base64.StdEncoding.EncodeToString(nonce)
+	host := p.Host
+	if v, ok := p.Param("sni"); ok && secure {
+		host = v
+	}
+	req := fmt.Sprintf("GET /%s HTTP/1.1\r\nHost: %s\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"+
+		"Sec-WebSocket-Key: %s\r\nSec-WebSocket-Version: 13\r\nSec-WebSocket-Protocol: ygg-ws\r\n\r\n",
+		p.Path, net.JoinHostPort(host, p.Port), key)
+	if _, err := conn.Write([]byte(req)); err != nil {
+		conn.Close()
+		return nil, res, err
+	}
+
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, nil)
+	if err != nil {
+		conn.Close()
+		return nil, res, fmt.Errorf("WebSocket upgrade: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		conn.Close()
+		return nil, res, fmt.Errorf("WebSocket upgrade: server answered %s", resp.Status)
+	}
+	sum := sha1.Sum([]byte(key + wsGUID))
+	if resp.Header.Get("Sec-WebSocket-Accept") != base64.StdEncoding.EncodeToString(sum[:]) {
+		conn.Close()
+		return nil, res, fmt.Errorf("WebSocket upgrade: bad Sec-WebSocket-Accept")
+	}
+	if !strings.EqualFold(resp.Header.Get("Upgrade"), "websocket") {
+		conn.Close()
+		return nil, res, fmt.Errorf("WebSocket upgrade: missing Upgrade header")
+	}
+	// Servers may leave the subprotocol out, but must not pick another one
+	if proto := resp.Header.Get("Sec-WebSocket-Protocol"); proto != "" && proto != "ygg-ws" {
+		conn.Close()
+		return nil, res, fmt.Errorf("WebSocket upgrade: server chose subprotocol %q, not ygg-ws", proto)
+	}
+	res.Handshake += time.Since(start)
+	return &bufferedConn{Conn: conn, r: r}, res, nil
+}
+
+// quicProber completes a QUIC handshake the way a Yggdrasil node dials:
+// TLS 1.3 without ALPN and without checking the self-signed certificate.
+type quicProber struct{}
+
+func (quicProber) Probe(ctx context.Context, p *PeerURI, timeout time.Duration) (ProbeResult, error) {
+	conn, res, err := dialQUIC(ctx, p, timeout)
+	if err != nil {
+		return res, err
+	}
+	conn.Close()
+	return res, nil
+}
+
+// quicConn is the one stream a Yggdrasil QUIC link carries.
+type quicConn struct {
+	*quic.Stream
+	conn *quic.Conn
+}
+
+func (c *quicConn) LocalAddr() net.Addr  { return c.conn.LocalAddr() }
+func (c *quicConn) RemoteAddr() net.Addr { return c.conn.RemoteAddr() }
+
+func (c *quicConn) Close() error {
+	return c.conn.CloseWithError(0, "")
+}
+
+// dialQUIC completes the QUIC handshake and opens the link's stream. A
+// stream only reaches the other side once a frame is sent on it, so our
+// half is closed right away: the empty FIN makes the node accept the stream
+// and send its metadata without us sending any.
+func dialQUIC(ctx context.Context, p *PeerURI, timeout time.Duration) (net.Conn, ProbeResult, error) {
+	var res ProbeResult
+	start := time.Now()
+	dialCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	qc, err := quic.DialAddr(dialCtx, p.Address(), &tls.Config{
+		ServerName:         p.SNI(),
+		InsecureSkipVerify: true,
+		MinVersion:         tls.VersionTLS13,
+	}, &quic.Config{HandshakeIdleTimeout: timeout})
+	if err != nil {
+		return nil, res, fmt.Errorf("QUIC handshake: %v", err)
+	}
+	res.Handshake = time.Since(start)
+
+	stream, err := qc.OpenStreamSync(dialCtx)
+	if err != nil {
+		qc.CloseWithError(0, "")
+		return nil, res, fmt.Errorf("QUIC stream: %v", err)
+	}
+	stream.Close()
+	stream.SetDeadline(start.Add(timeout))
+	return watchConn(ctx, &quicConn{Stream: stream, conn: qc}), res, nil
+}
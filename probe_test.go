@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+// listenTCP accepts connections and hands them to handle until the test ends.
+func listenTCP(t *testing.T, handle func(net.Conn)) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go handle(conn)
+		}
+	}()
+	return ln.Addr().String()
+}
+
+// silent holds connections open without a word, so handshakes time out.
+func silent(conn net.Conn) {
+	time.Sleep(2 * time.Second)
+	conn.Close()
+}
+
+// wsUpgrader answers the upgrade with the given accept key and subprotocol.
+// An accept of "" sends the correct key.
+func wsUpgrader(accept, proto string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if accept == "" {
+			sum := sha1.Sum([]byte(r.Header.Get("Sec-WebSocket-Key") + wsGUID))
+			accept = base64.StdEncoding.EncodeToString(sum[:])
+		}
+		conn, buf, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		fmt.Fprintf(buf, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"+
+			"Sec-WebSocket-Accept: %s\r\n", accept)
+		if proto != "" {
+			fmt.Fprintf(buf, "Sec-WebSocket-Protocol: %s\r\n", proto)
+		}
+		buf.WriteString("\r\n")
+		buf.Flush()
+	}
+}
+
+func serverURI(t *testing.T, scheme string, srv *httptest.Server) string {
+	t.Helper()
+	t.Cleanup(srv.Close)
+	return scheme + "://" + strings.TrimPrefix(strings.TrimPrefix(srv.URL, "https://"), "http://")
+}
+
+// listenQUIC accepts QUIC connections configured like a Yggdrasil node's
+// (self-signed certificate, TLS 1.3, no ALPN) and hands the first stream of
+// each to handle. With a nil handle it is a UDP socket that never answers.
+func listenQUIC(t *testing.T, handle func(*quic.Stream)) string {
+	t.Helper()
+	if handle == nil {
+		pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { pc.Close() })
+		return pc.LocalAddr().String()
+	}
+
+	tmpl := &x509.Certificate{SerialNumber: big.NewInt(1), NotAfter: time.Now().Add(time.Hour)}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, testKey.Public(), testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := quic.ListenAddr("127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: testKey}},
+		MinVersion:   tls.VersionTLS13,
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			qc, err := ln.Accept(context.Background())
+			if err != nil {
+				return
+			}
+			go func() {
+				defer qc.CloseWithError(0, "")
+				stream, err := qc.AcceptStream(context.Background())
+				if err != nil {
+					return
+				}
+				handle(stream)
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestProbers(t *testing.T) {
+	tests := []struct {
+		name    string
+		uri     func(t *testing.T) string
+		wantErr string
+	}{
+		{"tcp", func(t *testing.T) string { return "tcp://" + listenTCP(t, silent) }, ""},
+		{"tcp refused", func(t *testing.T) string {
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			ln.Close()
+			return "tcp://" + ln.Addr().String()
+		}, "refused"},
+		{"tls", func(t *testing.T) string {
+			return serverURI(t, "tls", httptest.NewTLSServer(http.NotFoundHandler()))
+		}, ""},
+		{"tls timeout", func(t *testing.T) string { return "tls://" + listenTCP(t, silent) }, "TLS handshake"},
+		{"ws", func(t *testing.T) string { return serverURI(t, "ws", httptest.NewServer(wsUpgrader("", "ygg-ws"))) }, ""},
+		{"ws without subprotocol", func(t *testing.T) string {
+			return serverURI(t, "ws", httptest.NewServer(wsUpgrader("", "")))
+		}, ""},
+		{"ws bad accept", func(t *testing.T) string {
+			return serverURI(t, "ws", httptest.NewServer(wsUpgrader("bm90IHRoZSBrZXk=", "ygg-ws")))
+		}, "bad Sec-WebSocket-Accept"},
+		{"ws wrong subprotocol", func(t *testing.T) string {
+			return serverURI(t, "ws", httptest.NewServer(wsUpgrader("", "chat")))
+		}, `subprotocol "chat"`},
+		{"ws not upgraded", func(t *testing.T) string {
+			return serverURI(t, "ws", httptest.NewServer(http.NotFoundHandler()))
+		}, "404"},
+		{"ws timeout", func(t *testing.T) string { return "ws://" + listenTCP(t, silent) }, "WebSocket upgrade"},
+		{"wss", func(t *testing.T) string {
+			return serverURI(t, "wss", httptest.NewTLSServer(wsUpgrader("", "ygg-ws")))
+		}, ""},
+		{"quic", func(t *testing.T) string {
+			return "quic://" + listenQUIC(t, func(s *quic.Stream) { time.Sleep(time.Second) })
+		}, ""},
+		{"quic timeout", func(t *testing.T) string { return "quic://" + listenQUIC(t, nil) }, "QUIC handshake"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := parsePeerURI(tt.uri(t))
+			if err != nil {
+				t.Fatal(err)
+			}
+			res, err := proberFor(p.Scheme).Probe(context.Background(), p, 500*time.Millisecond)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("Probe() error = %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Fatalf("Probe() error = %v, want it to mention %q", err, tt.wantErr)
+			case tt.wantErr == "" && res.Total() <= 0:
+				t.Fatalf("Probe() took %v", res.Total())
+			}
+		})
+	}
+}
+
+func TestProbeCancel(t *testing.T) {
+	p, err := parsePeerURI("tls://" + listenTCP(t, silent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start := time.Now()
+	if _, err := proberFor("tls").Probe(ctx, p, 5*time.Second); err == nil {
+		t.Fatal("Probe() succeeded against a silent listener")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("Probe() returned %v after cancel, want promptly", elapsed)
+	}
+}
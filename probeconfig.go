@@ -0,0 +1,401 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AlecAivazis/survey/v2"
+	"github.com/AlecAivazis/survey/v2/terminal"
+)
+
+// --- Probe Settings ---
+
+// ProbeConfig holds the knobs of a peer scan. Zero fields are unset, so
+// configs can be layered: defaults, a preset, the settings file, flags.
+type ProbeConfig struct {
+	Preset       string
+	Attempts     int           // Probes per peer at least
+	MaxAttempts  int           // Probes per peer at most, see Sampler
+	Gap          time.Duration // Pause between a peer's probes
+	Timeout      time.Duration // One dial, handshake or probe
+	Workers      int           // Peers probed at once
+	MaxLatency   time.Duration // Slower peers aren't ranked
+	ScanDeadline time.Duration // Whole scan
+	Show         int           // Peers listed in the ranking
+	Strategy     string        // How peers are ranked, see parseStrategy
+}
+
+// scanPresets are starting points for common links. "default" is what the
+// tool uses when nothing is configured.
+var scanPresets = map[string]ProbeConfig{
+	"default": {
+		Attempts: 5, MaxAttempts: 15, Gap: 150 * time.Millisecond, Timeout: 3 * time.Second, Workers: 20,
+		MaxLatency: 5 * time.Second, ScanDeadline: 15 * time.Minute, Show: 10,
+	},
+	// Fast answer on a good link; slow peers are dropped early
+	"quick": {
+		Attempts: 2, MaxAttempts: 4, Gap: 50 * time.Millisecond, Timeout: 1500 * time.Millisecond, Workers: 50,
+		MaxLatency: time.Second, ScanDeadline: 3 * time.Minute, Show: 10,
+	},
+	// More samples per peer for steadier stability numbers
+	"thorough": {
+		Attempts: 10, MaxAttempts: 30, Gap: 300 * time.Millisecond, Timeout: 5 * time.Second, Workers: 20,
+		MaxLatency: 5 * time.Second, ScanDeadline: 30 * time.Minute, Show: 20,
+	},
+	// Satellite and metered links: few connections at a time, long timeouts
+	"low-bandwidth": {
+		Attempts: 3, MaxAttempts: 6, Gap: 500 * time.Millisecond, Timeout: 10 * time.Second, Workers: 4,
+		MaxLatency: 10 * time.Second, ScanDeadline: 30 * time.Minute, Show: 10,
+	},
+}
+
+func presetNames() []string {
+	names := make([]string, 0, len(scanPresets))
+	for name := range scanPresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// probeConfig is the configuration in effect, see resolveProbeConfig.
+var probeConfig = scanPresets["default"]
+
+// probeFlags holds the command line values; zero fields weren't given.
+var probeFlags ProbeConfig
+
+// apply overrides c with the fields set in o. A preset in o is applied
+// first, so fields given next to it win over the preset's values.
+func (c *ProbeConfig) apply(o ProbeConfig) {
+	if o.Preset != "" {
+		p := scanPresets[o.Preset]
+		p.Preset = ""
+		c.apply(p)
+		c.Preset = o.Preset
+	}
+	if o.Attempts > 0 {
+		c.Attempts = o.Attempts
+	}
+	if o.MaxAttempts > 0 {
+		c.MaxAttempts = o.MaxAttempts
+	}
+	if o.Gap > 0 {
+		c.Gap = o.Gap
+	}
+	if o.Timeout > 0 {
+		c.Timeout = o.Timeout
+	}
+	if o.Workers > 0 {
+		c.Workers = o.Workers
+	}
+	if o.MaxLatency > 0 {
+		c.MaxLatency = o.MaxLatency
+	}
+	if o.ScanDeadline > 0 {
+		c.ScanDeadline = o.ScanDeadline
+	}
+	if o.Show > 0 {
+		c.Show = o.Show
+	}
+	if o.Strategy != "" {
+		c.Strategy = o.Strategy
+	}
+}
+
+func (c ProbeConfig) validate() error {
+	if c.Preset != "" {
+		if _, ok := scanPresets[c.Preset]; !ok {
+			return fmt.Errorf("unknown scan preset %q (have %s)", c.Preset, strings.Join(presetNames(), ", "))
+		}
+	}
+	for _, n := range []struct {
+		name string
+		v    int
+	}{{"attempts", c.Attempts}, {"max attempts", c.MaxAttempts}, {"workers", c.Workers}, {"show", c.Show}} {
+		// 0 leaves the field unset, so the layer below decides
+		if n.v < 0 || n.v > 1000 {
+			return fmt.Errorf("%s must be between 1 and 1000, or 0 to use the default", n.name)
+		}
+	}
+	for _, d := range []struct {
+		name string
+		v    time.Duration
+	}{{"gap", c.Gap}, {"timeout", c.Timeout}, {"max latency", c.MaxLatency}, {"scan deadline", c.ScanDeadline}} {
+		if d.v < 0 {
+			return fmt.Errorf("%s can't be negative", d.name)
+		}
+	}
+	_, err := parseStrategy(c.Strategy)
+	return err
+}
+
+// resolveProbeConfig applies the settings file and then the flags over the
+// defaults.
+func resolveProbeConfig() error {
+	settings, err := loadSettings()
+	if err != nil {
+		return err
+	}
+	cfg := scanPresets["default"]
+	cfg.Preset = ""
+	for _, layer := range []ProbeConfig{settings.Probe, probeFlags} {
+		if err := layer.validate(); err != nil {
+			return err
+		}
+		cfg.apply(layer)
+	}
+	strategy, err := parseStrategy(cfg.Strategy)
+	if err != nil {
+		return err
+	}
+	probeConfig, rankStrategy = cfg, strategy
+	return nil
+}
+
+// probeConfigJSON is how a ProbeConfig is saved: durations as strings such
+// as "150ms", unset fields left out.
+type probeConfigJSON struct {
+	Preset       string `json:"preset,omitempty"`
+	Attempts     int    `json:"attempts,omitempty"`
+	MaxAttempts  int    `json:"max_attempts,omitempty"`
+	Gap          string `json:"gap,omitempty"`
+	Timeout      string `json:"timeout,omitempty"`
+	Workers      int    `json:"workers,omitempty"`
+	MaxLatency   string `json:"max_latency,omitempty"`
+	ScanDeadline string `json:"scan_deadline,omitempty"`
+	Show         int    `json:"show,omitempty"`
+	Strategy     string `json:"strategy,omitempty"`
+}
+
+func formatSetting(d time.Duration) string {
+	if d == 0 {
+		return ""
+	}
+	return d.String()
+}
+
+func (c ProbeConfig) MarshalJSON() ([]byte, error) {
+	return json.Marshal(probeConfigJSON{
+		Preset:       c.Preset,
+		Attempts:     c.Attempts,
+		MaxAttempts:  c.MaxAttempts,
+		Gap:          formatSetting(c.Gap),
+		Timeout:      formatSetting(c.Timeout),
+		Workers:      c.Workers,
+		MaxLatency:   formatSetting(c.MaxLatency),
+		ScanDeadline: formatSetting(c.ScanDeadline),
+		Show:         c.Show,
+		Strategy:     c.Strategy,
+	})
+}
+
+func (c *ProbeConfig) UnmarshalJSON(data []byte) error {
+	var j probeConfigJSON
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+	*c = ProbeConfig{Preset: j.Preset, Attempts: j.Attempts, MaxAttempts: j.MaxAttempts, Workers: j.Workers, Show: j.Show, Strategy: j.Strategy}
+	for _, d := range []struct {
+		name string
+		s    string
+		dst  *time.Duration
+	}{
+		{"gap", j.Gap, &c.Gap},
+		{"timeout", j.Timeout, &c.Timeout},
+		{"max_latency", j.MaxLatency, &c.MaxLatency},
+		{"scan_deadline", j.ScanDeadline, &c.ScanDeadline},
+	} {
+		if d.s == "" {
+			continue
+		}
+		v, err := time.ParseDuration(d.s)
+		if err != nil {
+			return fmt.Errorf("probe %s: %v", d.name, err)
+		}
+		*d.dst = v
+	}
+	return nil
+}
+
+func (c ProbeConfig) IsZero() bool {
+	return c == ProbeConfig{}
+}
+
+func printProbeConfig(c ProbeConfig) {
+	preset := c.Preset
+	if preset == "" {
+		preset = "default"
+	}
+	fmt.Printf("Preset:         %s\n", preset)
+	fmt.Printf("Attempts:       %d-%d per peer, %s apart\n", c.Attempts, max(c.Attempts, c.MaxAttempts), c.Gap)
+	fmt.Printf("Timeout:        %s per probe\n", c.Timeout)
+	fmt.Printf("Workers:        %d\n", c.Workers)
+	fmt.Printf("Latency cutoff: %s\n", c.MaxLatency)
+	fmt.Printf("Scan deadline:  %s\n", c.ScanDeadline)
+	fmt.Printf("Peers shown:    %d\n", c.Show)
+	strategy := c.Strategy
+	if strategy == "" {
+		strategy = defaultStrategy
+	}
+	fmt.Printf("Ranking:        %s\n", strategy)
+}
+
+// advancedMenu edits the saved scan settings.
+func advancedMenu() {
+	for {
+		clearScreen()
+		fmt.Println(cyan("=== Advanced Scan Settings ===\n"))
+		settings, err := loadSettings()
+		if err != nil {
+			fmt.Println(red("Error: "), err)
+			waitEnter()
+			return
+		}
+		printProbeConfig(probeConfig)
+		if !probeFlags.IsZero() {
+			fmt.Println(yellow("\nScan flags were given: they override the saved settings in this session."))
+		}
+		fmt.Println()
+
+		action := ""
+		err = survey.AskOne(&survey.Select{
+			Message: "Advanced Menu (Esc to back):",
+			Options: []string{
+				"Preset", "Attempts", "Max Attempts", "Gap Between Attempts", "Timeout", "Workers",
+				"Latency Cutoff", "Scan Deadline", "Peers Shown", "Ranking Strategy", "Reset to Defaults", "Back",
+			},
+			PageSize: 12,
+		}, &action)
+		if err == terminal.InterruptErr || action == "Back" || action == "" {
+			return
+		}
+
+		p := &settings.Probe
+		switch action {
+		case "Preset":
+			name := ""
+			if err := survey.AskOne(&survey.Select{Message: "Preset:", Options: presetNames(), Default: "default"}, &name); err != nil {
+				continue
+			}
+			// A preset replaces individual tweaks
+			*p = ProbeConfig{Preset: name}
+			if name == "default" {
+				p.Preset = ""
+			}
+		case "Attempts":
+			p.Attempts = askInt("Probes per peer, at least:", probeConfig.Attempts, p.Attempts)
+		case "Max Attempts":
+			p.MaxAttempts = askInt("Probes per peer, at most (more are made while the latency is uncertain):", probeConfig.MaxAttempts, p.MaxAttempts)
+		case "Workers":
+			p.Workers = askInt("Peers probed at once:", probeConfig.Workers, p.Workers)
+		case "Peers Shown":
+			p.Show = askInt("Peers listed in the ranking:", probeConfig.Show, p.Show)
+		case "Gap Between Attempts":
+			p.Gap = askDuration("Pause between probes:", probeConfig.Gap, p.Gap)
+		case "Timeout":
+			p.Timeout = askDuration("Timeout per probe:", probeConfig.Timeout, p.Timeout)
+		case "Latency Cutoff":
+			p.MaxLatency = askDuration("Don't rank peers slower than:", probeConfig.MaxLatency, p.MaxLatency)
+		case "Scan Deadline":
+			p.ScanDeadline = askDuration("Stop the whole scan after:", probeConfig.ScanDeadline, p.ScanDeadline)
+		case "Ranking Strategy":
+			p.Strategy = askStrategy(p.Strategy)
+		case "Reset to Defaults":
+			*p = ProbeConfig{}
+		}
+
+		if err := settings.Save(); err != nil {
+			fmt.Println(red("Failed to save settings: "), err)
+			waitEnter()
+			continue
+		}
+		if err := resolveProbeConfig(); err != nil {
+			fmt.Println(red("Error: "), err)
+			waitEnter()
+		}
+	}
+}
+
+func askInt(msg string, current, keep int) int {
+	s := ""
+	err := survey.AskOne(&survey.Input{Message: msg, Default: strconv.Itoa(current)}, &s,
+		survey.WithValidator(func(ans interface{}) error {
+			n, err := strconv.Atoi(strings.TrimSpace(ans.(string)))
+			if err != nil || n < 1 || n > 1000 {
+				return fmt.Errorf("enter a number from 1 to 1000")
+			}
+			return nil
+		}))
+	if err != nil {
+		return keep
+	}
+	n, _ := strconv.Atoi(strings.TrimSpace(s))
+	return n
+}
+
+func askDuration(msg string, current, keep time.Duration) time.Duration {
+	s := ""
+	err := survey.AskOne(&survey.Input{Message: msg, Default: current.String(), Help: "A duration such as 500ms, 3s or 10m"}, &s,
+		survey.WithValidator(func(ans interface{}) error {
+			d, err := time.ParseDuration(strings.TrimSpace(ans.(string)))
+			if err != nil || d <= 0 {
+				return fmt.Errorf("enter a duration such as 500ms, 3s or 10m")
+			}
+			return nil
+		}))
+	if err != nil {
+		return keep
+	}
+	d, _ := time.ParseDuration(strings.TrimSpace(s))
+	return d
+}
+
+// askStrategy picks a named strategy or takes a custom mix.
+func askStrategy(keep string) string {
+	const custom = "Custom mix..."
+	current := probeConfig.Strategy
+	if current == "" {
+		current = defaultStrategy
+	}
+	options := append(strategyNames(), custom)
+	def := custom
+	for _, name := range options {
+		if name == current {
+			def = name
+		}
+	}
+	name := ""
+	err := survey.AskOne(&survey.Select{
+		Message:  "Rank peers by:",
+		Options:  options,
+		Default:  def,
+		Help:     "balanced and diverse mix several scorers; the others rank by one aspect only",
+		PageSize: len(options),
+	}, &name)
+	if err != nil {
+		return keep
+	}
+	if name != custom {
+		if name == defaultStrategy {
+			return ""
+		}
+		return name
+	}
+	s := ""
+	err = survey.AskOne(&survey.Input{
+		Message: "Scorers with weights:",
+		Default: current,
+		Help:    "e.g. latency=3,diversity,protocol:tls/quic - scorers: " + strings.Join(scorerNames, ", "),
+	}, &s, survey.WithValidator(func(ans interface{}) error {
+		_, err := parseStrategy(ans.(string))
+		return err
+	}))
+	if err != nil {
+		return keep
+	}
+	return strings.TrimSpace(s)
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// --- Latency Sampling ---
+
+// samplerPrecision is the target half-width of the 95% confidence
+// interval of the mean, relative to the mean: probing stops once the
+// latency is known to within ±10%.
+const samplerPrecision = 0.10
+
+// LatencyStats summarises a peer's probes after outliers are dropped.
+type LatencyStats struct {
+	Samples  int // Successful probes kept
+	Lost     int // Failed probes
+	Outliers int // Successful probes dropped as outliers
+	P50      time.Duration
+	P90      time.Duration
+	P99      time.Duration
+	Mean     time.Duration
+	Min      time.Duration
+	Max      time.Duration
+	StdDev   time.Duration
+}
+
+// Loss is the share of probes that failed.
+func (s LatencyStats) Loss() float64 {
+	total := s.Samples + s.Outliers + s.Lost
+	if total == 0 {
+		return 1
+	}
+	return float64(s.Lost) / float64(total)
+}
+
+// Sampler collects probe results for one peer and decides when there are
+// enough: at least Min probes, then more until the mean is precise enough
+// or Max probes were made.
+type Sampler struct {
+	Min, Max int
+	samples  []time.Duration
+	lost     int
+}
+
+func newSampler() *Sampler {
+	return &Sampler{Min: probeConfig.Attempts, Max: max(probeConfig.Attempts, probeConfig.MaxAttempts)}
+}
+
+func (s *Sampler) Add(d time.Duration) {
+	s.samples = append(s.samples, d)
+}
+
+func (s *Sampler) Lose() {
+	s.lost++
+}
+
+func (s *Sampler) Tries() int {
+	return len(s.samples) + s.lost
+}
+
+// Done reports whether probing can stop. A peer that failed every one of
+// its first Min probes isn't probed further.
+func (s *Sampler) Done() bool {
+	n := s.Tries()
+	switch {
+	case n >= s.Max:
+		return true
+	case n < s.Min:
+		return false
+	case len(s.samples) == 0:
+		return true
+	}
+	kept, _ := rejectOutliers(s.samples)
+	if len(kept) < 2 {
+		return false
+	}
+	mean, sd := meanStdDev(kept)
+	halfWidth := 1.96 * sd / math.Sqrt(float64(len(kept)))
+	return mean > 0 && halfWidth/mean <= samplerPrecision
+}
+
+func (s *Sampler) Stats() LatencyStats {
+	st := LatencyStats{Lost: s.lost}
+	if len(s.samples) == 0 {
+		return st
+	}
+	kept, dropped := rejectOutliers(s.samples)
+	st.Samples, st.Outliers = len(kept), dropped
+	sorted := append([]time.Duration(nil), kept...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	st.P50 = percentile(sorted, 50)
+	st.P90 = percentile(sorted, 90)
+	st.P99 = percentile(sorted, 99)
+	st.Min, st.Max = sorted[0], sorted[len(sorted)-1]
+	mean, sd := meanStdDev(kept)
+	st.Mean, st.StdDev = time.Duration(mean), time.Duration(sd)
+	return st
+}
+
+// rejectOutliers drops slow samples far above the median, such as a probe
+// that waited for a SYN retransmit. "Far" is three scaled median absolute
+// deviations, and never less than a quarter of the median so that tight
+// clusters don't lose ordinary samples. Fast samples are never dropped.
+func rejectOutliers(samples []time.Duration) ([]time.Duration, int) {
+	if len(samples) < 3 {
+		return samples, 0
+	}
+	sorted := append([]time.Duration(nil), samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	median := float64(percentile(sorted, 50))
+	devs := make([]time.Duration, len(sorted))
+	for i, d := range sorted {
+		devs[i] = time.Duration(math.Abs(float64(d) - median))
+	}
+	sort.Slice(devs, func(i, j int) bool { return devs[i] < devs[j] })
+	mad := float64(percentile(devs, 50)) * 1.4826
+	limit := median + math.Max(3*mad, median/4)
+
+	kept := make([]time.Duration, 0, len(samples))
+	for _, d := range samples {
+		if float64(d) <= limit {
+			kept = append(kept, d)
+		}
+	}
+	return kept, len(samples) - len(kept)
+}
+
+// roundLatency keeps three significant digits or so for display.
+func roundLatency(d time.Duration) time.Duration {
+	switch {
+	case d >= 100*time.Millisecond:
+		return d.Round(time.Millisecond)
+	case d >= time.Millisecond:
+		return d.Round(100 * time.Microsecond)
+	}
+	return d.Round(time.Microsecond)
+}
+
+// percentile uses the nearest-rank method on sorted samples.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+func meanStdDev(samples []time.Duration) (float64, float64) {
+	var sum float64
+	for _, d := range samples {
+		sum += float64(d)
+	}
+	mean := sum / float64(len(samples))
+	var variance float64
+	for _, d := range samples {
+		diff := float64(d) - mean
+		variance += diff * diff
+	}
+	if len(samples) > 1 {
+		variance /= float64(len(samples) - 1)
+	}
+	return mean, math.Sqrt(variance)
+}
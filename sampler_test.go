@@ -0,0 +1,112 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func durations(ms ...float64) []time.Duration {
+	out := make([]time.Duration, len(ms))
+	for i, v := range ms {
+		out[i] = time.Duration(v * float64(time.Millisecond))
+	}
+	return out
+}
+
+func TestRejectOutliers(t *testing.T) {
+	tests := []struct {
+		name        string
+		in          []time.Duration
+		wantKept    []time.Duration
+		wantDropped int
+	}{
+		{"one spike", durations(40, 41, 1040, 42, 40), durations(40, 41, 42, 40), 1},
+		{"all equal", durations(30, 30, 30, 30), durations(30, 30, 30, 30), 0},
+		{"fast samples stay", durations(40, 41, 5, 42, 40), durations(40, 41, 5, 42, 40), 0},
+		{"spread within a quarter of the median", durations(40, 45, 48, 50), durations(40, 45, 48, 50), 0},
+		{"too few to judge", durations(40, 900), durations(40, 900), 0},
+		{"all zero", durations(0, 0, 0), durations(0, 0, 0), 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kept, dropped := rejectOutliers(tt.in)
+			if !reflect.DeepEqual(kept, tt.wantKept) || dropped != tt.wantDropped {
+				t.Errorf("rejectOutliers() = %v, %d, want %v, %d", kept, dropped, tt.wantKept, tt.wantDropped)
+			}
+		})
+	}
+}
+
+func TestSamplerStats(t *testing.T) {
+	s := &Sampler{Min: 3, Max: 10}
+	for _, d := range durations(40, 41, 1040, 42, 40) {
+		s.Add(d)
+	}
+	s.Lose()
+	st := s.Stats()
+	want := LatencyStats{
+		Samples: 4, Lost: 1, Outliers: 1,
+		P50: 40 * time.Millisecond, P90: 42 * time.Millisecond, P99: 42 * time.Millisecond,
+		Min: 40 * time.Millisecond, Max: 42 * time.Millisecond,
+	}
+	if st.Samples != want.Samples || st.Lost != want.Lost || st.Outliers != want.Outliers ||
+		st.P50 != want.P50 || st.P90 != want.P90 || st.P99 != want.P99 || st.Min != want.Min || st.Max != want.Max {
+		t.Errorf("Stats() = %+v, want %+v", st, want)
+	}
+	if loss := st.Loss(); math.Abs(loss-1.0/6) > 1e-9 {
+		t.Errorf("Loss() = %v, want 1/6", loss)
+	}
+	if (&Sampler{}).Stats().Loss() != 1 {
+		t.Error("Loss() of no probes should be 1")
+	}
+}
+
+func TestSamplerDone(t *testing.T) {
+	tests := []struct {
+		name    string
+		samples []time.Duration
+		lost    int
+		want    int // Tries when Done first reports true
+	}{
+		{"steady stops at Min", durations(40, 40, 40, 40, 40, 40), 0, 3},
+		{"all equal but zero runs to Max", durations(0, 0, 0, 0, 0, 0, 0, 0, 0, 0), 0, 10},
+		{"spike is ignored", durations(40, 1040, 41, 40, 41, 40), 0, 3},
+		{"noisy runs to Max", durations(20, 80, 30, 90, 25, 70, 20, 95, 30, 85, 40, 60), 0, 10},
+		{"dead stops at Min", nil, 3, 3},
+		{"one success needs a second", durations(40, 41), 2, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Sampler{Min: 3, Max: 10}
+			for i := 0; i < tt.lost; i++ {
+				s.Lose()
+			}
+			for _, d := range tt.samples {
+				if s.Done() {
+					break
+				}
+				s.Add(d)
+			}
+			for !s.Done() && s.Tries() < 100 {
+				s.Add(40 * time.Millisecond)
+			}
+			if s.Tries() != tt.want {
+				t.Errorf("Done() after %d tries, want %d", s.Tries(), tt.want)
+			}
+		})
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	sorted := durations(1, 2, 3, 4, 5, 6, 7, 8, 9, 10)
+	for p, want := range map[float64]time.Duration{0: time.Millisecond, 50: 5 * time.Millisecond, 90: 9 * time.Millisecond, 99: 10 * time.Millisecond} {
+		if got := percentile(sorted, p); got != want {
+			t.Errorf("percentile(%v) = %v, want %v", p, got, want)
+		}
+	}
+	if percentile(nil, 50) != 0 {
+		t.Error("percentile of no samples should be 0")
+	}
+}
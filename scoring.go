@@ -0,0 +1,389 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// --- Peer Scoring ---
+
+// A Scorer rates one aspect of a peer. Penalties run from 0 (best) to 1
+// (worst) so that scorers can be mixed with weights. ahead holds the peers
+// already ranked above, for scorers that care about the set as a whole.
+type Scorer interface {
+	Name() string
+	Penalty(p Peer, ahead *rankState) float64
+	Explain(p Peer, ahead *rankState) string
+}
+
+// WeightedScorer is a Scorer's share of a strategy.
+type WeightedScorer struct {
+	Scorer
+	Weight float64
+}
+
+// Strategy is a weighted mix of scorers; the weights add up to 1.
+type Strategy []WeightedScorer
+
+func (s Strategy) String() string {
+	parts := make([]string, len(s))
+	for i, ws := range s {
+		parts[i] = fmt.Sprintf("%s×%.2g", ws.Name(), ws.Weight)
+	}
+	return strings.Join(parts, " + ")
+}
+
+// defaultStrategy is used when none is configured.
+const defaultStrategy = "balanced"
+
+// namedStrategies are ready-made mixes, spelled as --strategy takes them.
+var namedStrategies = map[string]string{
+	"balanced": "latency=0.6,stability=0.25,uptime=0.15",
+	"diverse":  "latency=0.5,stability=0.2,uptime=0.1,diversity=0.2",
+}
+
+// scorerNames lists the built-in scorers in the order they're documented.
+var scorerNames = []string{"latency", "stability", "uptime", "diversity", "protocol"}
+
+// strategyNames lists every name --strategy takes on its own.
+func strategyNames() []string {
+	names := make([]string, 0, len(namedStrategies))
+	for name := range namedStrategies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return append(names, scorerNames...)
+}
+
+// parseStrategy reads a strategy: a named mix such as "balanced", or a
+// comma-separated list of scorer[:arg][=weight], e.g.
+// "latency=3,diversity,protocol:tls/quic". Weights default to 1 and are
+// scaled to add up to 1. An empty spec is the default strategy.
+func parseStrategy(spec string) (Strategy, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		spec = defaultStrategy
+	}
+	if named, ok := namedStrategies[spec]; ok {
+		spec = named
+	}
+	var s Strategy
+	seen := make(map[string]bool)
+	total := 0.0
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		weight := 1.0
+		if name, w, ok := strings.Cut(item, "="); ok {
+			v, err := strconv.ParseFloat(w, 64)
+			if err != nil || v <= 0 || math.IsInf(v, 0) {
+				return nil, fmt.Errorf("strategy %q: weight %q must be a positive number", spec, w)
+			}
+			item, weight = name, v
+		}
+		name, arg, _ := strings.Cut(item, ":")
+		scorer, err := newScorer(name, arg)
+		if err != nil {
+			return nil, fmt.Errorf("strategy %q: %v", spec, err)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("strategy %q: %s is given twice", spec, name)
+		}
+		seen[name] = true
+		s = append(s, WeightedScorer{Scorer: scorer, Weight: weight})
+		total += weight
+	}
+	for i := range s {
+		s[i].Weight /= total
+	}
+	return s, nil
+}
+
+func newScorer(name, arg string) (Scorer, error) {
+	if arg != "" && name != "protocol" {
+		return nil, fmt.Errorf("%s takes no argument", name)
+	}
+	switch name {
+	case "latency":
+		return latencyScorer{}, nil
+	case "stability":
+		return stabilityScorer{}, nil
+	case "uptime":
+		return uptimeScorer{}, nil
+	case "diversity":
+		return diversityScorer{}, nil
+	case "protocol":
+		order := defaultProtocolOrder
+		if arg != "" {
+			order = strings.Split(strings.ToLower(arg), "/")
+		}
+		return protocolScorer{Order: order}, nil
+	}
+	return nil, fmt.Errorf("unknown scorer %q (have %s)", name, strings.Join(strategyNames(), ", "))
+}
+
+// rankStrategy is the strategy in effect, see resolveProbeConfig.
+var rankStrategy, _ = parseStrategy(defaultStrategy)
+
+// ScorePart is one scorer's contribution to a peer's score.
+type ScorePart struct {
+	Name    string
+	Penalty float64 // 0-1, before weighting
+	Weight  float64
+	Reason  string
+}
+
+func (p ScorePart) Contribution() float64 {
+	return p.Penalty * p.Weight
+}
+
+// PeerScore is a peer's score under a strategy, lower is better.
+type PeerScore struct {
+	Total float64
+	Parts []ScorePart
+}
+
+// Summary is one line for the ranking, e.g.
+// "0.31 = latency 0.25 (p50 32ms, p90 40ms) + stability 0.01 (...)".
+func (s PeerScore) Summary() string {
+	parts := make([]string, len(s.Parts))
+	for i, p := range s.Parts {
+		parts[i] = fmt.Sprintf("%s %.2f (%s)", p.Name, p.Contribution(), p.Reason)
+	}
+	return fmt.Sprintf("%.2f = %s", s.Total, strings.Join(parts, " + "))
+}
+
+// rankState is what set-dependent scorers know about the peers ranked so
+// far: the rank at which each operator, country and region first appeared.
+type rankState struct {
+	operators, countries, regions map[string]int
+}
+
+func newRankState() *rankState {
+	return &rankState{operators: map[string]int{}, countries: map[string]int{}, regions: map[string]int{}}
+}
+
+func (st *rankState) add(p Peer, rank int) {
+	firstSeen(st.operators, p.Operator, rank)
+	firstSeen(st.countries, p.Country, rank)
+	firstSeen(st.regions, p.Region, rank)
+}
+
+func firstSeen(seen map[string]int, value string, rank int) {
+	key := strings.ToLower(value)
+	if _, ok := seen[key]; key != "" && !ok {
+		seen[key] = rank
+	}
+}
+
+// rankPeers orders peers by the strategy, best first. Peers are picked one
+// at a time so that set-dependent scorers such as diversity see the peers
+// already ranked above. Ties go to the lower median latency. Peers whose
+// handshake couldn't be checked come after every verified peer, whatever
+// their score.
+func rankPeers(peers []Peer, s Strategy) []Peer {
+	st := newRankState()
+	rest := append([]Peer(nil), peers...)
+	totals := make([]float64, len(rest))
+	ranked := make([]Peer, 0, len(rest))
+	for len(rest) > 0 {
+		best := 0
+		for i, p := range rest {
+			totals[i] = 0
+			for _, ws := range s {
+				totals[i] += ws.Weight * ws.Penalty(p, st)
+			}
+			if p.Unverifiable != rest[best].Unverifiable {
+				if !p.Unverifiable {
+					best = i
+				}
+				continue
+			}
+			if totals[i] < totals[best] || (totals[i] == totals[best] && p.Latency < rest[best].Latency) {
+				best = i
+			}
+		}
+		p := rest[best]
+		p.Score = PeerScore{Total: totals[best]}
+		for _, ws := range s {
+			p.Score.Parts = append(p.Score.Parts, ScorePart{
+				Name: ws.Name(), Penalty: ws.Penalty(p, st), Weight: ws.Weight, Reason: ws.Explain(p, st),
+			})
+		}
+		ranked = append(ranked, p)
+		st.add(p, len(ranked))
+		rest = append(rest[:best], rest[best+1:]...)
+		totals = totals[:len(rest)]
+	}
+	return ranked
+}
+
+// explainRank says what put ranked[i] below the peer just above it: the
+// part of the score that grew the most. Scores are taken at the time each
+// peer was picked, so a set-dependent scorer can leave a peer with a lower
+// total below one with a higher total.
+func explainRank(ranked []Peer, i int) string {
+	if i == 0 {
+		return "best score"
+	}
+	if ranked[i].Unverifiable && !ranked[i-1].Unverifiable {
+		return "below every verified peer, the handshake can't be checked over this link type"
+	}
+	prev := ranked[i-1].Score
+	cur := ranked[i].Score
+	switch {
+	case cur.Total < prev.Total:
+		return fmt.Sprintf("ranked after #%d because diversity re-scored it", i)
+	case cur.Total == prev.Total:
+		return fmt.Sprintf("tied with #%d, which has the lower latency", i)
+	}
+	worst, diff := "", 0.0
+	for j, part := range cur.Parts {
+		if d := part.Contribution() - prev.Parts[j].Contribution(); d > diff {
+			worst, diff = part.Name, d
+		}
+	}
+	return fmt.Sprintf("below #%d mostly on %s (+%.3f)", i, worst, diff)
+}
+
+// latencyScorer favours low latency on a log scale, so that 20ms against
+// 40ms counts as much as 200ms against 400ms. 1ms scores 0 and the latency
+// cutoff scores 1. The p90 tail weighs in a little.
+type latencyScorer struct{}
+
+func (latencyScorer) Name() string { return "latency" }
+
+func (latencyScorer) Penalty(p Peer, _ *rankState) float64 {
+	latency := 0.7*float64(p.Latency) + 0.3*float64(p.P90)
+	floor, cutoff := float64(time.Millisecond), float64(probeConfig.MaxLatency)
+	if latency <= floor || cutoff <= floor {
+		return 0
+	}
+	return math.Min(1, math.Log(latency/floor)/math.Log(cutoff/floor))
+}
+
+func (latencyScorer) Explain(p Peer, _ *rankState) string {
+	return fmt.Sprintf("p50 %s, p90 %s", roundLatency(p.Latency), roundLatency(p.P90))
+}
+
+// stabilityScorer favours steady latency and no loss.
+type stabilityScorer struct{}
+
+func (stabilityScorer) Name() string { return "stability" }
+
+func (stabilityScorer) Penalty(p Peer, _ *rankState) float64 {
+	return 1 - (1-math.Min(1, p.Stability))*(1-p.Loss)
+}
+
+func (stabilityScorer) Explain(p Peer, _ *rankState) string {
+	return fmt.Sprintf("jitter %s, loss %.0f%%", roundLatency(p.Jitter), p.Loss*100)
+}
+
+// uptimeScorer favours peers a status feed has seen up most of the time.
+// Peers without uptime data score halfway.
+type uptimeScorer struct{}
+
+func (uptimeScorer) Name() string { return "uptime" }
+
+func (uptimeScorer) Penalty(p Peer, _ *rankState) float64 {
+	if p.Feed == nil || p.Feed.Uptime < 0 {
+		return 0.5
+	}
+	return 1 - p.Feed.Uptime
+}
+
+func (uptimeScorer) Explain(p Peer, _ *rankState) string {
+	if p.Feed == nil || p.Feed.Uptime < 0 {
+		return "no uptime data"
+	}
+	return fmt.Sprintf("uptime %.0f%%", p.Feed.Uptime*100)
+}
+
+// diversityScorer favours peers unlike those ranked above: another
+// operator, country and region, so that one outage doesn't take every
+// peer down. Unknown operators and locations don't count as repeats.
+type diversityScorer struct{}
+
+func (diversityScorer) Name() string { return "diversity" }
+
+func (d diversityScorer) Penalty(p Peer, ahead *rankState) float64 {
+	penalty, _ := d.repeat(p, ahead)
+	return penalty
+}
+
+func (d diversityScorer) Explain(p Peer, ahead *rankState) string {
+	if _, why := d.repeat(p, ahead); why != "" {
+		return why
+	}
+	if p.Operator == "" && p.Country == "" && p.Region == "" {
+		return "no operator or location data"
+	}
+	return "new operator and location"
+}
+
+// repeat finds the strongest overlap with a peer ranked above.
+func (diversityScorer) repeat(p Peer, ahead *rankState) (float64, string) {
+	for _, c := range []struct {
+		what    string
+		value   string
+		seen    map[string]int
+		penalty float64
+	}{
+		{"operator", p.Operator, ahead.operators, 1},
+		{"country", p.Country, ahead.countries, 0.5},
+		{"region", p.Region, ahead.regions, 0.25},
+	} {
+		if rank, ok := c.seen[strings.ToLower(c.value)]; c.value != "" && ok {
+			return c.penalty, fmt.Sprintf("same %s (%s) as #%d", c.what, c.value, rank)
+		}
+	}
+	return 0, ""
+}
+
+// defaultProtocolOrder prefers encrypted, widely reachable transports.
+var defaultProtocolOrder = []string{"tls", "quic", "wss", "tcp", "ws"}
+
+// protocolScorer favours transports early in Order; others score 1.
+type protocolScorer struct {
+	Order []string
+}
+
+func (protocolScorer) Name() string { return "protocol" }
+
+func (s protocolScorer) Penalty(p Peer, _ *rankState) float64 {
+	i := s.index(p)
+	if i < 0 {
+		return 1
+	}
+	return float64(i) / float64(len(s.Order))
+}
+
+func (s protocolScorer) Explain(p Peer, _ *rankState) string {
+	scheme := peerScheme(p.URI)
+	switch i := s.index(p); {
+	case i < 0:
+		return scheme + ", not preferred"
+	case i == 0:
+		return scheme + ", preferred"
+	default:
+		return fmt.Sprintf("%s, choice %d of %d", scheme, i+1, len(s.Order))
+	}
+}
+
+func (s protocolScorer) index(p Peer) int {
+	scheme := peerScheme(p.URI)
+	for i, name := range s.Order {
+		if name == scheme {
+			return i
+		}
+	}
+	return -1
+}
+
+func peerScheme(uri string) string {
+	scheme, _, _ := strings.Cut(uri, "://")
+	return strings.ToLower(scheme)
+}
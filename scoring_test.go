@@ -0,0 +1,169 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseStrategy(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    map[string]float64 // Normalised weights
+		wantErr string
+	}{
+		{spec: "", want: map[string]float64{"latency": 0.6, "stability": 0.25, "uptime": 0.15}},
+		{spec: "diverse", want: map[string]float64{"latency": 0.5, "stability": 0.2, "uptime": 0.1, "diversity": 0.2}},
+		{spec: "latency", want: map[string]float64{"latency": 1}},
+		{spec: "latency=3, diversity", want: map[string]float64{"latency": 0.75, "diversity": 0.25}},
+		{spec: "latency=2,stability=2,protocol:tls/quic=4", want: map[string]float64{"latency": 0.25, "stability": 0.25, "protocol": 0.5}},
+		{spec: "latency,latency=2", wantErr: "latency is given twice"},
+		{spec: "latency=0", wantErr: `weight "0" must be a positive number`},
+		{spec: "latency=-1", wantErr: `weight "-1" must be a positive number`},
+		{spec: "latency=fast", wantErr: `weight "fast" must be a positive number`},
+		{spec: "latency=", wantErr: `weight "" must be a positive number`},
+		{spec: "latency=Inf", wantErr: "must be a positive number"},
+		{spec: "uptime:30d", wantErr: "uptime takes no argument"},
+		{spec: "speed", wantErr: `unknown scorer "speed"`},
+		{spec: "latency,,uptime", wantErr: `unknown scorer ""`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			s, err := parseStrategy(tt.spec)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("parseStrategy() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			sum := 0.0
+			got := make(map[string]float64)
+			for _, ws := range s {
+				got[ws.Name()] = ws.Weight
+				sum += ws.Weight
+			}
+			if math.Abs(sum-1) > 1e-9 {
+				t.Errorf("weights add up to %v, want 1", sum)
+			}
+			for name, w := range tt.want {
+				if math.Abs(got[name]-w) > 1e-9 {
+					t.Errorf("%s weight = %v, want %v", name, got[name], w)
+				}
+			}
+			if len(got) != len(tt.want) {
+				t.Errorf("scorers = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProtocolScorerOrder(t *testing.T) {
+	s, err := parseStrategy("protocol:TLS/quic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for uri, want := range map[string]float64{"tls://a:1": 0, "quic://a:1": 0.5, "tcp://a:1": 1} {
+		if got := s[0].Penalty(Peer{URI: uri}, newRankState()); got != want {
+			t.Errorf("Penalty(%s) = %v, want %v", uri, got, want)
+		}
+	}
+}
+
+func TestRankPeers(t *testing.T) {
+	ms := time.Millisecond
+	peers := []Peer{
+		{URI: "tls://slow:1", Latency: 90 * ms, P90: 100 * ms, Country: "Japan", Region: "asia", Operator: "Carol"},
+		{URI: "tls://b:1", Latency: 22 * ms, P90: 25 * ms, Country: "Germany", Region: "europe", Operator: "Alice"},
+		{URI: "tls://a:1", Latency: 20 * ms, P90: 25 * ms, Country: "Germany", Region: "europe", Operator: "Alice"},
+		{URI: "tls://c:1", Latency: 40 * ms, P90: 60 * ms, Country: "France", Region: "europe", Operator: "Bob"},
+	}
+	tests := []struct {
+		spec string
+		want []string
+	}{
+		{"latency", []string{"tls://a:1", "tls://b:1", "tls://c:1", "tls://slow:1"}},
+		// Alice's second node drops below the other operators, and the
+		// second European peer below the only Asian one
+		{"latency,diversity", []string{"tls://a:1", "tls://slow:1", "tls://c:1", "tls://b:1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			s, err := parseStrategy(tt.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ranked := rankPeers(peers, s)
+			if got := uris(ranked); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("rankPeers() = %v, want %v", got, tt.want)
+			}
+			for i := 1; i < len(ranked); i++ {
+				if ranked[i].Score.Total < ranked[i-1].Score.Total {
+					t.Errorf("#%d scores %v, below #%d with %v", i+1, ranked[i].Score.Total, i, ranked[i-1].Score.Total)
+				}
+			}
+		})
+	}
+
+	s, _ := parseStrategy("latency,diversity")
+	last := rankPeers(peers, s)[3]
+	if why := last.Score.Parts[1].Reason; why != "same operator (Alice) as #1" {
+		t.Errorf("diversity reason = %q", why)
+	}
+}
+
+func TestExplainRank(t *testing.T) {
+	score := func(latency, diversity float64) PeerScore {
+		return PeerScore{Total: latency + diversity, Parts: []ScorePart{
+			{Name: "latency", Penalty: latency, Weight: 1},
+			{Name: "diversity", Penalty: diversity, Weight: 1},
+		}}
+	}
+	ranked := []Peer{
+		{Score: score(0.2, 0)},
+		{Score: score(0.2, 0.3)},
+		{Score: score(0.6, 0)},
+		{Score: score(0.6, 0)},
+		{Score: score(0.1, 0.2)},
+	}
+	want := []string{
+		"best score",
+		"below #1 mostly on diversity (+0.300)",
+		"below #2 mostly on latency (+0.400)",
+		"tied with #3, which has the lower latency",
+		"ranked after #4 because diversity re-scored it",
+	}
+	for i, w := range want {
+		if got := explainRank(ranked, i); got != w {
+			t.Errorf("explainRank(%d) = %q, want %q", i, got, w)
+		}
+	}
+}
+
+func TestRankPeersUnverifiableLast(t *testing.T) {
+	ms := time.Millisecond
+	peers := []Peer{
+		{URI: "quic://fast:1", Latency: 5 * ms, P90: 6 * ms, Unverifiable: true},
+		{URI: "tls://slow:1", Latency: 300 * ms, P90: 400 * ms},
+		{URI: "socks://proxy:1/b:2", Latency: 1 * ms, P90: 1 * ms, Unverifiable: true},
+		{URI: "tcp://mid:1", Latency: 90 * ms, P90: 100 * ms},
+	}
+	for _, spec := range []string{"", "latency", "protocol:quic/tls", "latency,diversity"} {
+		s, err := parseStrategy(spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ranked := rankPeers(peers, s)
+		got := uris(ranked)
+		if ranked[0].Unverifiable || ranked[1].Unverifiable || !ranked[2].Unverifiable || !ranked[3].Unverifiable {
+			t.Errorf("%q: rankPeers() = %v, want the verified peers first", spec, got)
+		}
+		if why := explainRank(ranked, 2); !strings.HasPrefix(why, "below every verified peer") {
+			t.Errorf("%q: explainRank(2) = %q", spec, why)
+		}
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/AlecAivazis/survey/v2"
+)
+
+// --- Diverse Selection ---
+
+// SelectionRules keep the picked peers from sharing a point of failure.
+type SelectionRules struct {
+	OnePerHost        bool // One URI per host name or address
+	DistinctNetworks  bool // No two peers in one IPv4 /24 or IPv6 /48
+	DistinctCountries bool
+	DistinctRegions   bool
+}
+
+// SkippedPeer is a ranked peer left out of a selection and why.
+type SkippedPeer struct {
+	Peer   Peer
+	Reason string
+}
+
+// Options of askSelectionRules, in SelectionRules field order.
+const (
+	ruleOnePerHost        = "One URI per host"
+	ruleDistinctNetworks  = "Distinct networks (IPv4 /24, IPv6 /48)"
+	ruleDistinctCountries = "Distinct countries"
+	ruleDistinctRegions   = "Distinct regions"
+)
+
+// askSelectionRules lets the user choose the constraints. Host and network
+// rules are on by default; location rules leave fewer peers to choose from.
+func askSelectionRules() (SelectionRules, bool) {
+	var picked []string
+	err := survey.AskOne(&survey.MultiSelect{
+		Message: "Spread the peers out:",
+		Options: []string{ruleOnePerHost, ruleDistinctNetworks, ruleDistinctCountries, ruleDistinctRegions},
+		Default: []string{ruleOnePerHost, ruleDistinctNetworks},
+		Help:    "Peers on one host or network, or in one place, tend to go down together",
+	}, &picked)
+	if err != nil {
+		return SelectionRules{}, false
+	}
+	var r SelectionRules
+	for _, p := range picked {
+		switch p {
+		case ruleOnePerHost:
+			r.OnePerHost = true
+		case ruleDistinctNetworks:
+			r.DistinctNetworks = true
+		case ruleDistinctCountries:
+			r.DistinctCountries = true
+		case ruleDistinctRegions:
+			r.DistinctRegions = true
+		}
+	}
+	return r, true
+}
+
+// selection tracks what the peers picked so far occupy, each mapped to the
+// peer that took it.
+type selection struct {
+	hosts, addrs, networks, countries, regions map[string]string
+}
+
+// newSelection starts with what the configured peers already occupy.
+func newSelection(configured []Peer) *selection {
+	s := &selection{
+		hosts: map[string]string{}, addrs: map[string]string{}, networks: map[string]string{},
+		countries: map[string]string{}, regions: map[string]string{},
+	}
+	for _, p := range configured {
+		s.add(p, "configured "+p.URI)
+	}
+	return s
+}
+
+// conflict says why p can't join the selection under r, or "" if it can.
+func (s *selection) conflict(p Peer, r SelectionRules) string {
+	if r.OnePerHost {
+		if by, ok := s.hosts[peerHost(p.URI)]; ok {
+			return "same host as " + by
+		}
+		for _, ip := range peerIPs(p) {
+			if by, ok := s.addrs[ip.String()]; ok {
+				return fmt.Sprintf("same address (%s) as %s", ip, by)
+			}
+		}
+	}
+	if r.DistinctNetworks {
+		for _, ip := range peerIPs(p) {
+			if by, ok := s.networks[networkPrefix(ip)]; ok {
+				return fmt.Sprintf("same network (%s) as %s", networkPrefix(ip), by)
+			}
+		}
+	}
+	if by, ok := s.countries[strings.ToLower(p.Country)]; r.DistinctCountries && p.Country != "" && ok {
+		return fmt.Sprintf("same country (%s) as %s", p.Country, by)
+	}
+	if by, ok := s.regions[strings.ToLower(p.Region)]; r.DistinctRegions && p.Region != "" && ok {
+		return fmt.Sprintf("same region (%s) as %s", p.Region, by)
+	}
+	return ""
+}
+
+func (s *selection) add(p Peer, label string) {
+	if host := peerHost(p.URI); host != "" {
+		s.hosts[host] = label
+	}
+	for _, ip := range peerIPs(p) {
+		s.addrs[ip.String()] = label
+		s.networks[networkPrefix(ip)] = label
+	}
+	if p.Country != "" {
+		s.countries[strings.ToLower(p.Country)] = label
+	}
+	if p.Region != "" {
+		s.regions[strings.ToLower(p.Region)] = label
+	}
+}
+
+// selectDiverse walks the ranking and picks up to n peers that obey the
+// rules, best first. What the configured peers occupy counts as taken, see
+// describeConfigured. Peers passed over on the way are returned with the
+// reason.
+func selectDiverse(ranked []Peer, n int, r SelectionRules, configured []Peer) ([]Peer, []SkippedPeer) {
+	s := newSelection(configured)
+	var picked []Peer
+	var skipped []SkippedPeer
+	for _, p := range ranked {
+		if len(picked) == n {
+			break
+		}
+		if why := s.conflict(p, r); why != "" {
+			skipped = append(skipped, SkippedPeer{Peer: p, Reason: why})
+			continue
+		}
+		picked = append(picked, p)
+		s.add(p, fmt.Sprintf("#%d", len(picked)))
+	}
+	return picked, skipped
+}
+
+// fillSelection tops picked up to n with the best peers it doesn't have,
+// relaxing the rules: new hosts first, then anything.
+func fillSelection(ranked, picked []Peer, n int, configured []Peer) []Peer {
+	s := newSelection(configured)
+	have := make(map[string]bool)
+	for _, p := range picked {
+		s.add(p, p.URI)
+		have[p.URI] = true
+	}
+	for _, r := range []SelectionRules{{OnePerHost: true}, {}} {
+		for _, p := range ranked {
+			if len(picked) == n {
+				return picked
+			}
+			if !have[p.URI] && s.conflict(p, r) == "" {
+				picked = append(picked, p)
+				s.add(p, p.URI)
+				have[p.URI] = true
+			}
+		}
+	}
+	return picked
+}
+
+// describeConfigured turns configured peers into Peers the selection rules
+// can compare against: their hosts are resolved, and their country, region
+// and operator are taken from the peer lists entry for the same host.
+func describeConfigured(ctx context.Context, configured []ConfiguredPeer, candidates []PeerCandidate) []Peer {
+	byHost := make(map[string]PeerCandidate)
+	for _, c := range candidates {
+		if host := peerHost(c.URI); host != "" {
+			if _, ok := byHost[host]; !ok {
+				byHost[host] = c
+			}
+		}
+	}
+	out := make([]Peer, len(configured))
+	var wg sync.WaitGroup
+	for i, cp := range configured {
+		out[i].URI = cp.URI
+		if c, ok := byHost[peerHost(cp.URI)]; ok {
+			out[i].Country, out[i].Region, out[i].Operator = c.Country, c.Region, c.Operator
+		}
+		p, err := parsePeerURI(cp.URI)
+		if err != nil {
+			continue
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if groups, err := familyGroups(ctx, p); err == nil {
+				out[i].Families = groups
+			}
+		}(i)
+	}
+	wg.Wait()
+	return out
+}
+
+// unplacedPeers returns the peers whose network couldn't be compared
+// because no address is known for them: socks and unix peers, which this
+// host doesn't resolve.
+func unplacedPeers(peers []Peer) []Peer {
+	var out []Peer
+	for _, p := range peers {
+		if len(peerIPs(p)) == 0 {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// peerHost is the lowercased host of a peer URI, "" for unix sockets and
+// URIs that don't parse.
+func peerHost(uri string) string {
+	p, err := parsePeerURI(uri)
+	if err != nil || p.Scheme == "unix" {
+		return ""
+	}
+	return strings.ToLower(p.Host)
+}
+
+// peerIPs is every address the peer's host resolved to during the scan.
+func peerIPs(p Peer) []net.IP {
+	var ips []net.IP
+	for _, f := range p.Families {
+		ips = append(ips, f.Addrs...)
+	}
+	return ips
+}
+
+// networkPrefix is the /24 of an IPv4 address or the /48 of an IPv6 one,
+// the usual size of a single site's allocation.
+func networkPrefix(ip net.IP) string {
+	if v4 := ip.To4(); v4 != nil {
+		return (&net.IPNet{IP: v4.Mask(net.CIDRMask(24, 32)), Mask: net.CIDRMask(24, 32)}).String()
+	}
+	return (&net.IPNet{IP: ip.Mask(net.CIDRMask(48, 128)), Mask: net.CIDRMask(48, 128)}).String()
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+)
+
+func familiesOf(addrs ...string) []FamilyResult {
+	v4, v6 := FamilyResult{Family: "IPv4"}, FamilyResult{Family: "IPv6"}
+	for _, a := range addrs {
+		ip := net.ParseIP(a)
+		if ip.To4() != nil {
+			v4.Addrs = append(v4.Addrs, ip)
+		} else {
+			v6.Addrs = append(v6.Addrs, ip)
+		}
+	}
+	return []FamilyResult{v6, v4}
+}
+
+func uris(peers []Peer) []string {
+	out := make([]string, len(peers))
+	for i, p := range peers {
+		out[i] = p.URI
+	}
+	return out
+}
+
+func TestSelectDiverse(t *testing.T) {
+	ranked := []Peer{
+		{URI: "tls://a.example:1", Families: familiesOf("192.0.2.4"), Country: "Germany", Region: "europe"},
+		{URI: "tcp://A.example:2", Families: familiesOf("192.0.2.4"), Country: "Germany", Region: "europe"},
+		{URI: "tls://b.example:1", Families: familiesOf("192.0.2.9"), Country: "Germany", Region: "europe"},
+		{URI: "tls://alias.example:1", Families: familiesOf("192.0.2.4")},
+		{URI: "tls://c.example:1", Families: familiesOf("198.51.100.8"), Country: "Germany", Region: "europe"},
+		{URI: "tls://d.example:1", Families: familiesOf("2001:db8:1:2::1"), Country: "France", Region: "europe"},
+		{URI: "tls://e.example:1", Families: familiesOf("2001:db8:1:ff::1"), Country: "Japan", Region: "asia"},
+		{URI: "tls://f.example:1", Families: familiesOf("203.0.113.5"), Country: "Brazil", Region: "south-america"},
+	}
+	hostAndNet := SelectionRules{OnePerHost: true, DistinctNetworks: true}
+	tests := []struct {
+		name       string
+		rules      SelectionRules
+		configured []Peer
+		want       []string
+		skipped    map[string]string
+	}{
+		{
+			name: "no rules",
+			want: []string{"tls://a.example:1", "tcp://A.example:2", "tls://b.example:1"},
+		},
+		{
+			name:  "host and network",
+			rules: hostAndNet,
+			want:  []string{"tls://a.example:1", "tls://c.example:1", "tls://d.example:1"},
+			skipped: map[string]string{
+				"tcp://A.example:2":     "same host as #1",
+				"tls://b.example:1":     "same network (192.0.2.0/24) as #1",
+				"tls://alias.example:1": "same address (192.0.2.4) as #1",
+			},
+		},
+		{
+			name:  "countries",
+			rules: SelectionRules{OnePerHost: true, DistinctNetworks: true, DistinctCountries: true},
+			want:  []string{"tls://a.example:1", "tls://d.example:1", "tls://f.example:1"},
+			skipped: map[string]string{
+				"tls://c.example:1": "same country (Germany) as #1",
+				"tls://e.example:1": "same network (2001:db8:1::/48) as #2",
+			},
+		},
+		{
+			// Peers without a known region don't count as repeats
+			name:  "regions",
+			rules: SelectionRules{DistinctRegions: true},
+			want:  []string{"tls://a.example:1", "tls://alias.example:1", "tls://e.example:1"},
+		},
+		{
+			name:  "configured peers occupy hosts, networks and countries",
+			rules: SelectionRules{OnePerHost: true, DistinctNetworks: true, DistinctCountries: true},
+			configured: []Peer{
+				{URI: "tcp://a.example:9"},
+				{URI: "tls://other.example:1", Families: familiesOf("2001:db8:1::7")},
+				{URI: "tls://g.example:1", Country: "Brazil"},
+			},
+			want: []string{"tls://b.example:1"},
+			skipped: map[string]string{
+				"tls://a.example:1": "same host as configured tcp://a.example:9",
+				"tls://d.example:1": "same network (2001:db8:1::/48) as configured tls://other.example:1",
+				"tls://f.example:1": "same country (Brazil) as configured tls://g.example:1",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			picked, skipped := selectDiverse(ranked, 3, tt.rules, tt.configured)
+			if got := uris(picked); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("picked %v, want %v", got, tt.want)
+			}
+			reasons := make(map[string]string)
+			for _, s := range skipped {
+				reasons[s.Peer.URI] = s.Reason
+			}
+			for uri, want := range tt.skipped {
+				if reasons[uri] != want {
+					t.Errorf("%s skipped for %q, want %q", uri, reasons[uri], want)
+				}
+			}
+		})
+	}
+}
+
+func TestFillSelection(t *testing.T) {
+	ranked := []Peer{
+		{URI: "tls://a.example:1", Country: "Germany"},
+		{URI: "tcp://a.example:2", Country: "Germany"},
+		{URI: "tls://b.example:1", Country: "Germany"},
+		{URI: "tls://c.example:1", Country: "Germany"},
+	}
+	configured := []Peer{{URI: "tcp://b.example:9"}}
+	rules := SelectionRules{OnePerHost: true, DistinctCountries: true}
+	picked, _ := selectDiverse(ranked, 3, rules, configured)
+	if got := uris(picked); !reflect.DeepEqual(got, []string{"tls://a.example:1"}) {
+		t.Fatalf("picked %v", got)
+	}
+	// New hosts first, skipping the configured one, then a second URI for a host
+	got := uris(fillSelection(ranked, picked, 3, configured))
+	want := []string{"tls://a.example:1", "tls://c.example:1", "tcp://a.example:2"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("fillSelection() = %v, want %v", got, want)
+	}
+}
+
+func TestDescribeConfigured(t *testing.T) {
+	configured := []ConfiguredPeer{{URI: "tls://192.0.2.1:443"}, {URI: "socks://proxy:1080/peer.example:1"}, {URI: "bogus"}}
+	candidates := []PeerCandidate{{URI: "tcp://192.0.2.1:80", Country: "Germany", Region: "europe", Operator: "Alice"}}
+	got := describeConfigured(context.Background(), configured, candidates)
+	if len(got) != 3 {
+		t.Fatalf("describeConfigured() = %d peers", len(got))
+	}
+	if got[0].Country != "Germany" || got[0].Region != "europe" || got[0].Operator != "Alice" {
+		t.Errorf("location = %q %q %q, want it from the candidate for the same host", got[0].Country, got[0].Region, got[0].Operator)
+	}
+	if ips := peerIPs(got[0]); len(ips) != 1 || !ips[0].Equal(net.ParseIP("192.0.2.1")) {
+		t.Errorf("addresses = %v", ips)
+	}
+	if unplaced := uris(unplacedPeers(got)); !reflect.DeepEqual(unplaced, []string{configured[1].URI, "bogus"}) {
+		t.Errorf("unplacedPeers() = %v", unplaced)
+	}
+}
+
+func TestNetworkPrefix(t *testing.T) {
+	for in, want := range map[string]string{
+		"192.0.2.200":              "192.0.2.0/24",
+		"::ffff:192.0.2.1":         "192.0.2.0/24",
+		"2001:db8:abcd:12::1":      "2001:db8:abcd::/48",
+		"2001:db8:abcd:ffff::ffff": "2001:db8:abcd::/48",
+	} {
+		if got := networkPrefix(net.ParseIP(in)); got != want {
+			t.Errorf("networkPrefix(%s) = %s, want %s", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// --- Settings ---
+
+// Settings are ygglazy's own preferences, kept apart from the Yggdrasil
+// config in <user config dir>/ygglazy/settings.json.
+type Settings struct {
+	Sources     []string    `json:"sources,omitempty"`
+	PeersRepo   string      `json:"peers_repo,omitempty"`   // owner/name
+	PeersBranch string      `json:"peers_branch,omitempty"` // Default: master
+	GitHubAPI   string      `json:"github_api,omitempty"`   // Default: https://api.github.com
+	Probe       ProbeConfig `json:"probe,omitzero"`         // Scan tuning, see ProbeConfig
+}
+
+// settingsPath is the settings file in the user config dir. There is no
+// fallback such as /tmp, where anyone could plant settings for root.
+func settingsPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("no config directory for settings: %v", err)
+	}
+	return filepath.Join(dir, "ygglazy", "settings.json"), nil
+}
+
+// privateDir checks dir with checkPrivateDir before anything in it is read
+// or written. A missing dir is created when create is set, and reported as
+// os.ErrNotExist otherwise.
+func privateDir(dir string, create bool) error {
+	if create {
+		if err := os.MkdirAll(filepath.Dir(dir), 0755); err != nil {
+			return err
+		}
+		if err := os.Mkdir(dir, 0700); err != nil && !os.IsExist(err) {
+			return err
+		}
+	}
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory; refusing to use it", dir)
+	}
+	return checkPrivateDir(dir, info)
+}
+
+// loadSettings returns the saved settings, or defaults if there are none.
+func loadSettings() (*Settings, error) {
+	s := &Settings{}
+	path, err := settingsPath()
+	if err != nil {
+		return s, nil // Nowhere to keep settings, so none were saved
+	}
+	if err := privateDir(filepath.Dir(path), false); os.IsNotExist(err) {
+		return s, nil
+	} else if err != nil {
+		return s, fmt.Errorf("reading %s: %v", path, err)
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return s, fmt.Errorf("reading %s: %v", path, err)
+	}
+	if err := json.Unmarshal(data, s); err != nil {
+		return &Settings{}, fmt.Errorf("reading %s: %v", path, err)
+	}
+	return s, nil
+}
+
+func (s *Settings) Save() error {
+	path, err := settingsPath()
+	if err != nil {
+		return err
+	}
+	if err := privateDir(filepath.Dir(path), true); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, append(data, '\n'), 0644)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestSettingsPrivateDir(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no owner or mode bits on Windows")
+	}
+	isolateDirs(t)
+	path, err := settingsPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Dir(path)
+
+	if s, err := loadSettings(); err != nil || !reflect.DeepEqual(s, &Settings{}) {
+		t.Fatalf("loadSettings() without a file = %+v, %v", s, err)
+	}
+	saved := &Settings{Sources: []string{"dir:/srv/peers"}}
+	if err := saved.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := os.Stat(dir); info.Mode().Perm() != 0700 {
+		t.Errorf("settings dir created %v, want 0700", info.Mode().Perm())
+	}
+
+	// Directories written by older versions are tightened, not refused
+	os.Chmod(dir, 0755)
+	if s, err := loadSettings(); err != nil || !reflect.DeepEqual(s, saved) {
+		t.Errorf("loadSettings() from a 0755 dir = %+v, %v", s, err)
+	}
+	if info, _ := os.Stat(dir); info.Mode().Perm() != 0700 {
+		t.Errorf("0755 dir left at %v, want 0700", info.Mode().Perm())
+	}
+
+	os.Chmod(dir, 0777)
+	if _, err := loadSettings(); err == nil || !strings.Contains(err.Error(), "writable by other users") {
+		t.Errorf("loadSettings() from a 0777 dir: %v", err)
+	}
+	if err := saved.Save(); err == nil {
+		t.Error("Save() wrote into a 0777 dir")
+	}
+	os.Chmod(dir, 0700)
+
+	if os.Geteuid() == 0 {
+		os.Chown(dir, 4242, 4242)
+		if _, err := loadSettings(); err == nil || !strings.Contains(err.Error(), "belongs to uid 4242") {
+			t.Errorf("loadSettings() from another user's dir: %v", err)
+		}
+		os.Chown(dir, 0, 0)
+	}
+
+	// A symlink to a dir someone else controls is refused as well
+	os.RemoveAll(dir)
+	other := t.TempDir()
+	os.Symlink(other, dir)
+	if _, err := loadSettings(); err == nil {
+		t.Error("loadSettings() followed a symlinked settings dir")
+	}
+}
+
+func TestSettingsWithoutConfigDir(t *testing.T) {
+	t.Setenv("HOME", "")
+	t.Setenv("XDG_CONFIG_HOME", "")
+	t.Setenv("AppData", "")
+	if s, err := loadSettings(); err != nil || !reflect.DeepEqual(s, &Settings{}) {
+		t.Errorf("loadSettings() = %+v, %v, want defaults", s, err)
+	}
+	if err := (&Settings{}).Save(); err == nil {
+		t.Error("Save() found somewhere to write without a config dir")
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// --- Status Feed ---
+
+// feedMaxSilence is how long a peer may go unseen by the status feed
+// before auto-select stops probing it.
+const feedMaxSilence = 24 * time.Hour
+
+// FeedStatus is what a public peers status page reports about one peer.
+// Zero values mean the feed didn't say.
+type FeedStatus struct {
+	Up           bool
+	LastSeen     time.Time
+	ResponseTime time.Duration // As measured by the status page, not from here
+	Uptime       float64       // 0-1, or -1 if unknown
+
+	uptimeRaw bool // Uptime is as the feed wrote it, see scaleFeedUptimes
+}
+
+// Summary describes the status for peer listings.
+func (f *FeedStatus) Summary() string {
+	if f == nil {
+		return "no status data"
+	}
+	parts := []string{"down"}
+	if f.Up {
+		parts[0] = "up"
+	}
+	if f.Uptime >= 0 {
+		parts = append(parts, fmt.Sprintf("uptime %.0f%%", f.Uptime*100))
+	}
+	if f.ResponseTime > 0 {
+		parts = append(parts, "responds in "+f.ResponseTime.Round(time.Millisecond).String()+" from the status page")
+	}
+	if !f.LastSeen.IsZero() {
+		parts = append(parts, "seen "+formatAge(f.LastSeen))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// StatusFeedSource reads a status page's JSON. The expected layout is the
+// one of the public peers status pages,
+//
+//	{"region": {"country.md": {"tls://host:port": {"up": true, ...}}}}
+//
+// but any nesting works: every object keyed by a peer URI is read, and the
+// top-level keys are taken as regions.
+type StatusFeedSource struct {
+	URL string
+}
+
+func (s *StatusFeedSource) Spec() string { return "status:" + s.URL }
+
+func (s *StatusFeedSource) Load(ctx context.Context) ([]PeerCandidate, time.Time, error) {
+	body, stale, err := httpGet(ctx, s.URL)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	var doc interface{}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return nil, time.Time{}, fmt.Errorf("status feed is not JSON: %v", err)
+	}
+	var out []PeerCandidate
+	if obj, ok := doc.(map[string]interface{}); ok {
+		for _, region := range sortedKeys(obj) {
+			out = append(out, collectFeedPeers(obj[region], region, "")...)
+		}
+	} else {
+		out = collectFeedPeers(doc, "", "")
+	}
+	scaleFeedUptimes(out)
+	if len(out) == 0 {
+		return nil, time.Time{}, fmt.Errorf("no peers found in %s", s.URL)
+	}
+	return out, stale, nil
+}
+
+func sortedKeys(obj map[string]interface{}) []string {
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// collectFeedPeers walks the feed for peer entries. Keys ending in ".md" on
+// the way name the country. Lists of objects with a "uri" field are read too.
+func collectFeedPeers(v interface{}, region, country string) []PeerCandidate {
+	var out []PeerCandidate
+	switch v := v.(type) {
+	case []interface{}:
+		for _, item := range v {
+			out = append(out, collectFeedPeers(item, region, country)...)
+		}
+	case map[string]interface{}:
+		for _, key := range []string{"uri", "URI", "address", "peer"} {
+			if uri, ok := v[key].(string); ok {
+				if _, err := parsePeerURI(uri); err == nil {
+					return []PeerCandidate{{URI: uri, Region: region, Country: country, Feed: parseFeedStatus(v)}}
+				}
+			}
+		}
+		for _, k := range sortedKeys(v) {
+			if _, err := parsePeerURI(k); err == nil {
+				fields, _ := v[k].(map[string]interface{})
+				out = append(out, PeerCandidate{URI: k, Region: region, Country: country, Feed: parseFeedStatus(fields)})
+				continue
+			}
+			c := country
+			if strings.HasSuffix(k, ".md") {
+				c = countryFromFile(k)
+			}
+			out = append(out, collectFeedPeers(v[k], region, c)...)
+		}
+	}
+	return out
+}
+
+// parseFeedStatus reads the fields status pages commonly use. A peer listed
+// without details is taken to be up.
+func parseFeedStatus(fields map[string]interface{}) *FeedStatus {
+	f := &FeedStatus{Up: true, Uptime: -1}
+	if fields == nil {
+		return f
+	}
+	for _, key := range []string{"up", "online", "alive"} {
+		if up, ok := fields[key].(bool); ok {
+			f.Up = up
+		}
+	}
+	if status, ok := fields["status"].(string); ok {
+		f.Up = strings.EqualFold(status, "up") || strings.EqualFold(status, "online")
+	}
+	for _, key := range []string{"last_seen", "lastSeen", "last_up"} {
+		if t, ok := feedTime(fields[key]); ok {
+			f.LastSeen = t
+		}
+	}
+	for _, key := range []string{"response_ms", "response_time", "latency_ms", "rtt_ms"} {
+		if ms, ok := fields[key].(float64); ok && ms > 0 {
+			f.ResponseTime = time.Duration(ms * float64(time.Millisecond))
+		}
+	}
+	for _, key := range []string{"uptime", "availability"} {
+		if u, ok := fields[key].(float64); ok && u >= 0 {
+			f.Uptime, f.uptimeRaw = u, true
+		}
+	}
+	for _, key := range []string{"uptime_percent", "uptime_pct"} {
+		if u, ok := fields[key].(float64); ok && u >= 0 {
+			f.Uptime, f.uptimeRaw = u/100, false
+		}
+	}
+	return f
+}
+
+// scaleFeedUptimes turns the uptimes of a feed into fractions. A plain
+// "uptime" may be a fraction or a percentage, but one feed writes all of
+// them the same way: any value above 1 means the feed uses percentages, and
+// then a reported 1 is 1%, not 100%.
+func scaleFeedUptimes(peers []PeerCandidate) {
+	percent := false
+	for _, c := range peers {
+		if c.Feed != nil && c.Feed.uptimeRaw && c.Feed.Uptime > 1 {
+			percent = true
+		}
+	}
+	for _, c := range peers {
+		if c.Feed == nil || !c.Feed.uptimeRaw {
+			continue
+		}
+		if percent {
+			c.Feed.Uptime /= 100
+		}
+		c.Feed.uptimeRaw = false
+	}
+}
+
+// feedTime accepts Unix seconds or milliseconds, or an RFC 3339 string.
+func feedTime(v interface{}) (time.Time, bool) {
+	switch v := v.(type) {
+	case float64:
+		if v <= 0 {
+			return time.Time{}, false
+		}
+		if v > 1e12 {
+			return time.UnixMilli(int64(v)), true
+		}
+		return time.Unix(int64(v), 0), true
+	case string:
+		if t, err := time.Parse(time.RFC3339, v); err == nil {
+			return t, true
+		}
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return feedTime(float64(n))
+		}
+	}
+	return time.Time{}, false
+}
+
+// feedSkipReason says why a peer isn't worth probing, or "" if it is.
+func feedSkipReason(f *FeedStatus) string {
+	switch {
+	case f == nil:
+		return ""
+	case !f.Up:
+		return "down"
+	case !f.LastSeen.IsZero() && time.Since(f.LastSeen) > feedMaxSilence:
+		return "last seen " + formatAge(f.LastSeen)
+	}
+	return ""
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// isolateDirs points the cache and settings at a fresh directory so tests
+// don't touch or depend on the user's files.
+func isolateDirs(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("HOME", dir)
+	t.Setenv("XDG_CACHE_HOME", dir+"/cache")
+	t.Setenv("XDG_CONFIG_HOME", dir+"/config")
+}
+
+func serveFeed(t *testing.T, body string) string {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func TestStatusFeedLoad(t *testing.T) {
+	isolateDirs(t)
+	seen := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		body string
+		want []PeerCandidate
+	}{
+		{
+			name: "nested region and country.md",
+			body: `{"europe": {"germany.md": {
+				"tls://a.example:443": {"up": true, "uptime": 99.5, "last_seen": 1790856000000},
+				"tcp://b.example:80": {"up": false, "uptime": 0.25, "last_seen": "2026-10-01T12:00:00Z"}
+			}}, "asia": {"south-korea.md": {"quic://c.example:443": {}}}}`,
+			want: []PeerCandidate{
+				{URI: "quic://c.example:443", Region: "asia", Country: "South Korea", Feed: &FeedStatus{Up: true, Uptime: -1}},
+				// The feed writes percentages, so this is 0.25%
+				{URI: "tcp://b.example:80", Region: "europe", Country: "Germany", Feed: &FeedStatus{Up: false, Uptime: 0.0025, LastSeen: seen}},
+				{URI: "tls://a.example:443", Region: "europe", Country: "Germany", Feed: &FeedStatus{Up: true, Uptime: 0.995, LastSeen: seen}},
+			},
+		},
+		{
+			name: "uri list",
+			body: `[{"uri": "tls://d.example:443", "status": "online", "availability": 87, "response_ms": 42, "last_seen": "1790856000"},
+				{"address": "tcp://e.example:1", "alive": false}, {"uri": "not a peer"}]`,
+			want: []PeerCandidate{
+				{URI: "tls://d.example:443", Feed: &FeedStatus{Up: true, Uptime: 0.87, LastSeen: seen, ResponseTime: 42 * time.Millisecond}},
+				{URI: "tcp://e.example:1", Feed: &FeedStatus{Up: false, Uptime: -1}},
+			},
+		},
+		{
+			name: "percentages with a 1",
+			body: `{"europe": {"tls://g.example:443": {"uptime": 1}, "tls://h.example:443": {"uptime": 98}, "tls://i.example:443": {"uptime_percent": 50}}}`,
+			want: []PeerCandidate{
+				{URI: "tls://g.example:443", Region: "europe", Feed: &FeedStatus{Up: true, Uptime: 0.01}},
+				{URI: "tls://h.example:443", Region: "europe", Feed: &FeedStatus{Up: true, Uptime: 0.98}},
+				{URI: "tls://i.example:443", Region: "europe", Feed: &FeedStatus{Up: true, Uptime: 0.5}},
+			},
+		},
+		{
+			name: "fractions",
+			body: `{"europe": {"tls://g.example:443": {"uptime": 1}, "tls://h.example:443": {"uptime": 0.5}, "tls://i.example:443": {"uptime_pct": 75}}}`,
+			want: []PeerCandidate{
+				{URI: "tls://g.example:443", Region: "europe", Feed: &FeedStatus{Up: true, Uptime: 1}},
+				{URI: "tls://h.example:443", Region: "europe", Feed: &FeedStatus{Up: true, Uptime: 0.5}},
+				{URI: "tls://i.example:443", Region: "europe", Feed: &FeedStatus{Up: true, Uptime: 0.75}},
+			},
+		},
+		{
+			name: "region with uri list",
+			body: `{"north-america": [{"peer": "tls://f.example:443", "uptime": 1, "last_seen": "2026-10-01T14:00:00+02:00"}]}`,
+			want: []PeerCandidate{
+				{URI: "tls://f.example:443", Region: "north-america", Feed: &FeedStatus{Up: true, Uptime: 1, LastSeen: seen}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := &StatusFeedSource{URL: serveFeed(t, tt.body)}
+			got, _, err := src.Load(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("Load() = %d peers, want %d: %+v", len(got), len(tt.want), got)
+			}
+			for i, w := range tt.want {
+				g := got[i]
+				if g.URI != w.URI || g.Region != w.Region || g.Country != w.Country {
+					t.Errorf("peer %d = %s %q %q, want %s %q %q", i, g.URI, g.Region, g.Country, w.URI, w.Region, w.Country)
+				}
+				if g.Feed.Up != w.Feed.Up || math.Abs(g.Feed.Uptime-w.Feed.Uptime) > 1e-9 ||
+					!g.Feed.LastSeen.Equal(w.Feed.LastSeen) || g.Feed.ResponseTime != w.Feed.ResponseTime {
+					t.Errorf("%s feed = %+v, want %+v", g.URI, *g.Feed, *w.Feed)
+				}
+			}
+		})
+	}
+}
+
+func TestStatusFeedLoadErrors(t *testing.T) {
+	isolateDirs(t)
+	for name, body := range map[string]string{
+		"not JSON": "<html>",
+		"no peers": `{"europe": {"germany.md": {"note": "nothing here"}}}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			src := &StatusFeedSource{URL: serveFeed(t, body)}
+			if got, _, err := src.Load(context.Background()); err == nil {
+				t.Fatalf("Load() = %v, want an error", got)
+			}
+		})
+	}
+}
+
+func TestFeedTime(t *testing.T) {
+	want := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	for _, v := range []interface{}{1790856000.0, 1790856000000.0, "1790856000", "2026-10-01T12:00:00Z"} {
+		if got, ok := feedTime(v); !ok || !got.Equal(want) {
+			t.Errorf("feedTime(%v) = %v, %v, want %v", v, got, ok, want)
+		}
+	}
+	for _, v := range []interface{}{0.0, -5.0, "yesterday", nil, true} {
+		if got, ok := feedTime(v); ok {
+			t.Errorf("feedTime(%v) = %v, want no time", v, got)
+		}
+	}
+}
+
+func TestFeedSummary(t *testing.T) {
+	for _, tt := range []struct {
+		f    *FeedStatus
+		want string
+	}{
+		{nil, "no status data"},
+		{&FeedStatus{Uptime: -1}, "down"},
+		{&FeedStatus{Up: true, Uptime: 0.995, ResponseTime: 42400 * time.Microsecond}, "up, uptime 100%, responds in 42ms from the status page"},
+		{&FeedStatus{Up: true, Uptime: -1, LastSeen: time.Now().Add(-3 * time.Hour)}, "up, seen 3h ago"},
+	} {
+		if got := tt.f.Summary(); got != tt.want {
+			t.Errorf("Summary() = %q, want %q", got, tt.want)
+		}
+	}
+}